@@ -8,43 +8,150 @@ import (
 	"sync"
 	"syscall"
 	"time"
+
+	"github.com/mhp/tacoma/driver"
 )
 
 // See: http://www.ti.com/lit/ds/symlink/ads1015.pdf
 
 type adc struct {
-	fd   int
-	lock sync.Mutex
+	fd    int
+	model *model
+	// comparator is the channel converting continuously to drive
+	// ALERT/RDY, or nil when conversions are single-shot
+	comparator *Channel
+	lock       sync.Mutex
 }
 
-func (adc *adc) Convert(ch int) (int, error) {
+// Convert performs a single-shot conversion.  mux, pga and dr are the
+// field values for the config register, as listed in the tables in
+// models.go.
+func (adc *adc) Convert(mux, pga, dr byte) (int, error) {
 	adc.lock.Lock()
 	defer adc.lock.Unlock()
 
-	config := []byte{
-		0x01,	// Write to config reigster
-		0xC3 | ((byte(ch)<<4)&0x30),	// Start single ended conversion, 4.096V FSR
-		0x83,	// 1600sps, alert/rdy --> hi-Z
+	if c := adc.comparator; c != nil {
+		// The converter is busy running the comparator, but the
+		// latest result is there for the taking on that channel
+		if c.mux != mux || c.pga != pga || c.dr != dr {
+			return 0, fmt.Errorf("Converter is dedicated to the comparator on %v", c.Name)
+		}
+		return adc.readResult()
+	}
+
+	config := uint16(0x8100) | // Start single-shot conversion
+		uint16(mux&0x07)<<12 | uint16(pga&0x07)<<9 |
+		uint16(dr&0x07)<<5 | 0x0003 // alert/rdy --> hi-Z
+
+	if err := adc.writeRegister(configRegister, config); err != nil {
+		return 0, err
+	}
+
+	// The conversion takes about one sample period, but the internal
+	// oscillator can run up to 10% slow, so poll for it to finish
+	period := time.Second / time.Duration(adc.model.dataRates[dr])
+	time.Sleep(period)
+
+	deadline := time.Now().Add(period * conversionTimeout)
+	for {
+		status, err := adc.readRegister(configRegister)
+		if err != nil {
+			return 0, err
+		}
+
+		// OS bit is set once the device is no longer converting
+		if status&0x8000 != 0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			return 0, fmt.Errorf("Conversion timed out after %v", period*conversionTimeout)
+		}
+		time.Sleep(period / conversionPolls)
+	}
+
+	return adc.readResult()
+}
+
+// StartComparator switches to continuous conversion of the channel, with
+// ALERT/RDY asserted (high) once a reading exceeds high, and released
+// once a reading falls below low.
+func (adc *adc) StartComparator(c *Channel, low, high int) error {
+	adc.lock.Lock()
+	defer adc.lock.Unlock()
+
+	if adc.comparator != nil {
+		return fmt.Errorf("Comparator is already in use by %v", adc.comparator.Name)
+	}
+
+	// Thresholds are left-justified like conversion results
+	shift := uint(16 - adc.model.bits)
+	if err := adc.writeRegister(loThreshRegister, uint16(int16(low<<shift))); err != nil {
+		return err
+	}
+	if err := adc.writeRegister(hiThreshRegister, uint16(int16(high<<shift))); err != nil {
+		return err
+	}
+
+	config := uint16(c.mux&0x07)<<12 | uint16(c.pga&0x07)<<9 | // Continuous conversion
+		uint16(c.dr&0x07)<<5 |
+		0x0008 // Traditional comparator, active high, non-latching, assert after one reading
+
+	if err := adc.writeRegister(configRegister, config); err != nil {
+		return err
 	}
 
-	n, err := syscall.Write(adc.fd, config)
+	adc.comparator = c
+	return nil
+}
+
+// readResult reads the last conversion
+func (adc *adc) readResult() (int, error) {
+	result, err := adc.readRegister(conversionRegister)
 	if err != nil {
 		return 0, err
-	} else if n != len(config) {
-		return 0, errors.New("bad len (cfg)")
 	}
 
-	// 1600 samples per second implies a delay of 625us
-	time.Sleep(625 * time.Microsecond)
+	// Result is a two's complement value formatted MSB first.  For
+	// 12-bit parts the bottom 4 bits are zero, so shift them away.
+	return int(int16(result)) >> uint(16-adc.model.bits), nil
+}
+
+const (
+	conversionRegister = 0x00
+	configRegister     = 0x01
+	loThreshRegister   = 0x02
+	hiThreshRegister   = 0x03
 
-	// Prepare to read - write the address register first
-	setConvReg := []byte{
-		0x00,	// Select conversion register
+	// conversionTimeout is how many sample periods to wait for a
+	// conversion before giving up
+	conversionTimeout = 4
+	// conversionPolls is how many times to check for completion
+	// during each sample period
+	conversionPolls = 4
+)
+
+// writeRegister sets a 16-bit register
+func (adc *adc) writeRegister(reg byte, value uint16) error {
+	data := []byte{reg, byte(value >> 8), byte(value)}
+	n, err := syscall.Write(adc.fd, data)
+	if err != nil {
+		return err
+	} else if n != len(data) {
+		return errors.New("bad len (write)")
 	}
-	n, err = syscall.Write(adc.fd, setConvReg)
+
+	return nil
+}
+
+// readRegister selects a register and reads its 16-bit value
+func (adc *adc) readRegister(reg byte) (uint16, error) {
+	// Prepare to read - write the address register first
+	selectReg := []byte{reg}
+	n, err := syscall.Write(adc.fd, selectReg)
 	if err != nil {
 		return 0, err
-	} else if n != len(setConvReg) {
+	} else if n != len(selectReg) {
 		return 0, errors.New("bad len (select)")
 	}
 
@@ -56,15 +163,25 @@ func (adc *adc) Convert(ch int) (int, error) {
 		return 0, errors.New("bad len (read)")
 	}
 
-	// Result is formatted MSB first, with bottom 4 bits as zero
-	// Repack it it make a 12-bit value
-	return int(result[0])<<4 | int(result[1]>>4), nil
+	return uint16(result[0])<<8 | uint16(result[1]), nil
 }
 
 type Channel struct {
-	Name    string
-	channel int
-	adc     *adc
+	Name         string
+	mux          byte
+	differential bool
+	pga          byte
+	dr           byte
+	adc          *adc
+	// alert is the input wired to ALERT/RDY when using the comparator
+	alert alertPin
+}
+
+// alertPin is what is needed of the input wired to ALERT/RDY, so that
+// comparator alerts can be used as edge triggers
+type alertPin interface {
+	GetEpollEvent(onRising, onFalling bool) (*syscall.EpollEvent, error)
+	IdentifyEdges(*syscall.EpollEvent) (edges []driver.Edge, dropped int)
 }
 
 func (c *Channel) SetInput() error {
@@ -72,26 +189,124 @@ func (c *Channel) SetInput() error {
 	return nil
 }
 
-// 12-bit ADC
+// SetFullScale selects the PGA gain giving the full-scale range in volts
+func (c *Channel) SetFullScale(volts float64) error {
+	if c.adc.model.fixedPGA {
+		if volts != fullScales[fixedPGA] {
+			return fmt.Errorf("%v has a fixed full-scale range of %vV", c.adc.model.name, fullScales[fixedPGA])
+		}
+		return nil
+	}
+
+	for pga, fs := range fullScales {
+		if fs == volts {
+			c.pga = pga
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Unsupported full-scale range %vV (expected 6.144, 4.096, 2.048, 1.024, 0.512 or 0.256)", volts)
+}
+
+// FullScale gives the voltage of the input range, which a reading
+// of MaxValue+1 would represent
+func (c *Channel) FullScale() float64 {
+	if c.adc.model.fixedPGA {
+		return fullScales[fixedPGA]
+	}
+	return fullScales[c.pga]
+}
+
+func (c *Channel) SetSampleRate(sps int) error {
+	for dr, rate := range c.adc.model.dataRates {
+		if rate == sps {
+			c.dr = dr
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Unsupported sample rate %vsps for %v", sps, c.adc.model.name)
+}
+
+// Signed ADC, 12 or 16 bits depending on the model
 func (c *Channel) MaxValue() int {
-	return 4095
+	return c.adc.model.maxValue()
 }
 
-// Single-ended so never below zero
+// Differential inputs are signed, single-ended are never below zero
 func (c *Channel) MinValue() int {
+	if c.differential {
+		return -c.adc.model.maxValue() - 1
+	}
 	return 0
 }
 
+// SetComparator starts the window comparator on this channel, with alert
+// being the input connected to ALERT/RDY.  Readings above high give a
+// rising edge, and then readings below low give a falling edge.  The
+// converter is dedicated to this channel from then on.
+func (c *Channel) SetComparator(alert interface{}, low, high int) error {
+	if !c.adc.model.comparator {
+		return fmt.Errorf("%v has no comparator", c.adc.model.name)
+	}
+
+	ap, ok := alert.(alertPin)
+	if !ok {
+		return errors.New("Alert pin can't be used for edge triggers")
+	}
+
+	if low < c.MinValue() || high > c.MaxValue() || low > high {
+		return fmt.Errorf("Thresholds must satisfy %v <= low (%v) <= high (%v) <= %v", c.MinValue(), low, high, c.MaxValue())
+	}
+
+	if err := c.adc.StartComparator(c, low, high); err != nil {
+		return err
+	}
+
+	c.alert = ap
+	return nil
+}
+
+// GetEpollEvent passes through to the alert pin, so that comparator
+// edges can be used as triggers
+func (c *Channel) GetEpollEvent(onRising, onFalling bool) (*syscall.EpollEvent, error) {
+	if c.alert == nil {
+		return nil, errors.New("Triggers need an Alert pin for the comparator")
+	}
+	return c.alert.GetEpollEvent(onRising, onFalling)
+}
+
+func (c *Channel) IdentifyEdges(ev *syscall.EpollEvent) (edges []driver.Edge, dropped int) {
+	return c.alert.IdentifyEdges(ev)
+}
+
 func (c *Channel) ReadValue() (int, error) {
-	return c.adc.Convert(c.channel)
+	v, err := c.adc.Convert(c.mux, c.pga, c.dr)
+	if err != nil {
+		return 0, err
+	}
+
+	// Noise around 0V can give small negative single-ended readings
+	if v < 0 && !c.differential {
+		v = 0
+	}
+	return v, nil
+}
+
+// adcKey identifies a converter by its bus and address
+type adcKey struct {
+	dev  string
+	addr int
 }
 
-var adcMap = make(map[int]*adc)
+var adcMap = make(map[adcKey]*adc)
 
-func getADC(dev string, addr int) (*adc, error) {
-	// FIXME This assumes only one bus, so
-	// a single cache indexed by address is adequate
-	if adc, ok := adcMap[addr]; ok {
+func getADC(m *model, dev string, addr int) (*adc, error) {
+	key := adcKey{dev, addr}
+	if adc, ok := adcMap[key]; ok {
+		if adc.model != m {
+			return nil, fmt.Errorf("Converter at %v@%x is already in use as %v", dev, addr, adc.model.name)
+		}
 		return adc, nil
 	}
 
@@ -105,44 +320,46 @@ func getADC(dev string, addr int) (*adc, error) {
 	}
 
 	// Make an instance of the analogue to digital converter
-	adc := &adc{fd: fd}
+	adc := &adc{fd: fd, model: m}
 
 	// Cache the controller fd
-	adcMap[addr] = adc
+	adcMap[key] = adc
 
 	return adc, nil
 }
 
 const defaultAddress = 0x48
-const defaultBus = "/dev/i2c-1"
+
+var defaultBus = "/dev/i2c-1"
 
 var adsNames = regexp.MustCompile(`\A` +
-	// Base name followed by channel number
-	`ads1015:([0123])` +
+	// Model name followed by channel number, or differential pair
+	`(ads1[01]1[345]):([0-3](?:-[0-3])?)` +
 	// Optional i2c address in hex ("@48") starting with '@'
 	`(?:@([[:xdigit:]]{2}))?` +
+	// Optional i2c bus device ("/i2c-3") starting with '/'
+	`(?:/(i2c-[0-9]+))?` +
 	`\z`)
 
 const (
 	submatchAll = iota
+	submatchModel
 	submatchChan
 	submatchAddr
+	submatchBus
 	numSubmatchesExpected
 )
 
-func RecognisePin(name string) bool {
-	return adsNames.MatchString(name)
-}
-
 func CreatePin(name string) (*Channel, error) {
 	submatches := adsNames.FindStringSubmatch(name)
 	if len(submatches) != numSubmatchesExpected {
 		return nil, fmt.Errorf("Can't parse pin name: %v", name)
 	}
 
-	chNum, err := strconv.ParseUint(submatches[submatchChan], 10, 8)
-	if err != nil {
-		return nil, fmt.Errorf("Can't parse channel number: %v", name)
+	m := models[submatches[submatchModel]]
+	mux, ok := m.muxes[submatches[submatchChan]]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported channel for %v: %v", m.name, name)
 	}
 
 	thisAddr := defaultAddress
@@ -154,9 +371,21 @@ func CreatePin(name string) (*Channel, error) {
 		thisAddr = int(addr)
 	}
 
-	if c, err := getADC(defaultBus, thisAddr); err != nil {
+	thisBus := defaultBus
+	if len(submatches[submatchBus]) > 0 {
+		thisBus = "/dev/" + submatches[submatchBus]
+	}
+
+	if c, err := getADC(m, thisBus, thisAddr); err != nil {
 		return nil, err
 	} else {
-		return &Channel{name, int(chNum), c}, nil
+		return &Channel{
+			Name:         name,
+			mux:          mux,
+			differential: mux < 4, // single-ended inputs use the top half
+			pga:          defaultPGA,
+			dr:           defaultDR,
+			adc:          c,
+		}, nil
 	}
 }
@@ -0,0 +1,67 @@
+package ads1015
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/mhp/tacoma/driver"
+)
+
+type config struct {
+	// Bus is the i2c device used for converters
+	Bus string
+}
+
+func init() {
+	names := make([]string, 0, len(models))
+	for name := range models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		m := models[name]
+
+		syntax := m.name + ":0-1[@AA][/i2c-B] (differential input"
+		if len(m.muxes) > 1 {
+			syntax = m.name + ":C[@AA][/i2c-B] (channel C 0-3 or differential pair 0-1, 0-3, 1-3 or 2-3"
+		}
+		syntax += ", optional hex i2c address AA, default 48, optional bus /dev/i2c-B)"
+
+		capabilities := []string{"analogue input", "sample rate"}
+		if !m.fixedPGA {
+			capabilities = append(capabilities, "full-scale range")
+		}
+		if m.comparator {
+			capabilities = append(capabilities, "comparator alerts")
+		}
+
+		d := driver.Driver{
+			Name:         m.name,
+			Prefix:       m.name + ":",
+			Syntax:       syntax,
+			Capabilities: capabilities,
+			Create: func(name string) (interface{}, error) {
+				return CreatePin(name)
+			},
+		}
+
+		// The whole family shares one config block, which is
+		// named after the original driver
+		if m.name == "ads1015" {
+			d.Configure = configure
+		}
+
+		driver.Register(d)
+	}
+}
+
+func configure(raw json.RawMessage) error {
+	cfg := config{Bus: defaultBus}
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return err
+	}
+
+	defaultBus = cfg.Bus
+	return nil
+}
@@ -0,0 +1,97 @@
+package ads1015
+
+// See: http://www.ti.com/lit/ds/symlink/ads1015.pdf
+// and: http://www.ti.com/lit/ds/symlink/ads1115.pdf
+
+// model describes one member of the ADS101x/ADS111x family.  The
+// 12-bit ADS101x and 16-bit ADS111x parts share a register layout,
+// differing in resolution and data rates.  The x13 and x14 parts have
+// a single differential input, and the x13 lacks the PGA and comparator.
+type model struct {
+	name string
+	bits int
+	// muxes maps the channel names accepted to the MUX field of
+	// the config register
+	muxes map[string]byte
+	// fixedPGA is set for parts without a PGA, which always use the
+	// range given by the PGA field value defaultPGA
+	fixedPGA bool
+	// comparator is set for parts with threshold registers driving
+	// the ALERT/RDY output
+	comparator bool
+	// dataRates maps the DR field of the config register to samples
+	// per second
+	dataRates map[byte]int
+}
+
+// fullScales maps the PGA field of the config register to the
+// full-scale range in volts
+var fullScales = map[byte]float64{
+	0: 6.144,
+	1: 4.096,
+	2: 2.048,
+	3: 1.024,
+	4: 0.512,
+	5: 0.256,
+}
+
+// fourChannelMuxes are the inputs of the x15 parts
+var fourChannelMuxes = map[string]byte{
+	"0-1": 0,
+	"0-3": 1,
+	"1-3": 2,
+	"2-3": 3,
+	"0":   4,
+	"1":   5,
+	"2":   6,
+	"3":   7,
+}
+
+// oneChannelMuxes are the inputs of the x13 and x14 parts, which
+// ignore the MUX field
+var oneChannelMuxes = map[string]byte{
+	"0-1": 0,
+}
+
+var ads101xRates = map[byte]int{
+	0: 128,
+	1: 250,
+	2: 490,
+	3: 920,
+	4: 1600,
+	5: 2400,
+	6: 3300,
+}
+
+var ads111xRates = map[byte]int{
+	0: 8,
+	1: 16,
+	2: 32,
+	3: 64,
+	4: 128,
+	5: 250,
+	6: 475,
+	7: 860,
+}
+
+const (
+	// Power-on defaults are 2.048V for the PGA, and either 1600sps
+	// or 128sps.  We have always used 4.096V by default.
+	defaultPGA = 1 // 4.096V
+	fixedPGA   = 2 // 2.048V, for parts without a PGA
+	defaultDR  = 4 // 1600sps or 128sps
+)
+
+var models = map[string]*model{
+	"ads1013": {"ads1013", 12, oneChannelMuxes, true, false, ads101xRates},
+	"ads1014": {"ads1014", 12, oneChannelMuxes, false, true, ads101xRates},
+	"ads1015": {"ads1015", 12, fourChannelMuxes, false, true, ads101xRates},
+	"ads1113": {"ads1113", 16, oneChannelMuxes, true, false, ads111xRates},
+	"ads1114": {"ads1114", 16, oneChannelMuxes, false, true, ads111xRates},
+	"ads1115": {"ads1115", 16, fourChannelMuxes, false, true, ads111xRates},
+}
+
+// maxValue is the largest reading the model can return
+func (m *model) maxValue() int {
+	return 1<<uint(m.bits-1) - 1
+}
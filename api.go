@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mhp/tacoma/gpiochip"
+)
+
+const apiPrefix = "/api/v1/"
+
+// addAPIHandlers registers the json endpoints describing the system
+func addAPIHandlers() {
+	http.HandleFunc(apiPrefix+"hardware/gpio", gpioInfoHandler)
+	http.HandleFunc(apiPrefix+"history/", historyHandler)
+}
+
+func gpioInfoHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	chips, err := gpiochip.Enumerate()
+	if err != nil {
+		http.Error(w, "Unable to enumerate gpio chips", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(chips)
+}
+
+// defaultHistoryRange is how far back history queries go by default
+const defaultHistoryRange = 24 * time.Hour
+
+// historyHandler serves the logged readings of an input, as
+// history/<name>?from=<time>&to=<time>&tier=<tier>&format=<format>.
+// Times are RFC 3339, defaulting to the last day.  The tier is raw
+// (default), 1m or 1h, and the format is json (default) or csv.
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h, ok := histories[strings.TrimPrefix(r.URL.Path, apiPrefix+"history/")]
+	if !ok {
+		http.Error(w, "No history for input", http.StatusNotFound)
+		return
+	}
+
+	q := r.URL.Query()
+
+	to := time.Now()
+	if s := q.Get("to"); s != "" {
+		var err error
+		if to, err = time.Parse(time.RFC3339, s); err != nil {
+			http.Error(w, "Bad end time", http.StatusBadRequest)
+			return
+		}
+	}
+
+	from := to.Add(-defaultHistoryRange)
+	if s := q.Get("from"); s != "" {
+		var err error
+		if from, err = time.Parse(time.RFC3339, s); err != nil {
+			http.Error(w, "Bad start time", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if from.After(to) {
+		http.Error(w, "Start time is after end time", http.StatusBadRequest)
+		return
+	}
+
+	tier := q.Get("tier")
+	if tier == "" {
+		tier = "raw"
+	}
+
+	samples, err := h.query(tier, from, to)
+	if err != nil {
+		http.Error(w, "Unable to read history: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch q.Get("format") {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(samples)
+
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"time", "value"})
+		for _, s := range samples {
+			cw.Write([]string{
+				s.Time.UTC().Format(time.RFC3339Nano),
+				strconv.FormatFloat(s.Value, 'g', -1, 32),
+			})
+		}
+		cw.Flush()
+
+	default:
+		http.Error(w, "Unknown format (expected json or csv)", http.StatusBadRequest)
+	}
+}
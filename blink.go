@@ -0,0 +1,300 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PatternedOutput drives a digital output with a repeating pattern,
+// as well as accepting plain levels.  Patterns are written as:
+//
+//	blink:ON/OFF      eg blink:200ms/800ms
+//	pwm:DUTY%@FREQ    eg pwm:25%@10Hz
+//	morse:CODE[@UNIT] eg morse:... --- ...@100ms
+//
+// In morse code patterns a dot is on for one unit, a dash for three,
+// and symbols are separated by one unit off.  A space separates letters
+// with three units off, and the pattern repeats after seven units off.
+type PatternedOutput struct {
+	DigitalOutputPin
+	v chan<- patternRequest
+	// spec is the running pattern, for ?pattern
+	spec string
+	// fault is set when a step of the running pattern couldn't be
+	// written, and cleared when a new level or pattern is written
+	fault error
+	lock  sync.Mutex
+}
+
+type patternStep struct {
+	level bool
+	d     time.Duration
+}
+
+type patternRequest struct {
+	level  bool
+	steps  []patternStep // nil for a fixed level
+	spec   string        // as written, for a pattern
+	result chan<- error
+}
+
+const (
+	minPatternStep   = time.Millisecond * 5
+	maxSoftPWMFreq   = 100 // Hz
+	defaultMorseUnit = time.Millisecond * 100
+	blinkPrefix      = "blink:"
+	pwmPrefix        = "pwm:"
+	morsePrefix      = "morse:"
+)
+
+func NewPatternedOutput(p DigitalOutputPin) GenericOutputPin {
+	vchan := make(chan patternRequest)
+	po := &PatternedOutput{DigitalOutputPin: p, v: vchan}
+	go po.patternControl(vchan)
+
+	return po
+}
+
+// Write accepts a level or a pattern, returning any error from setting
+// the level or the first step of the pattern
+func (p *PatternedOutput) Write(value string) error {
+	value = strings.TrimSpace(value)
+
+	steps, err := parsePattern(value)
+	if err != nil {
+		return err
+	}
+
+	result := make(chan error)
+	if steps == nil {
+		p.v <- patternRequest{level: parseLevel(value), result: result}
+	} else {
+		p.v <- patternRequest{steps: steps, spec: value, result: result}
+	}
+	return <-result
+}
+
+// Fault reports a failure to write a later step of the running pattern
+func (p *PatternedOutput) Fault() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.fault
+}
+
+func (p *PatternedOutput) setFault(err error) {
+	p.lock.Lock()
+	p.fault = err
+	p.lock.Unlock()
+}
+
+func (p *PatternedOutput) setSpec(spec string) {
+	p.lock.Lock()
+	p.spec = spec
+	p.lock.Unlock()
+}
+
+// Read gives the level of the output, which changes as a pattern runs
+func (p *PatternedOutput) Read() (string, error) {
+	v, err := p.ReadBool()
+	if err != nil {
+		return "n/a", nil
+	}
+
+	if v {
+		return "1", nil
+	}
+	return "0", nil
+}
+
+func (p *PatternedOutput) Queries() []string {
+	return []string{"pattern"}
+}
+
+// ReadQuery supports ?pattern, giving the running pattern, or nothing
+// if the output was set to a level
+func (p *PatternedOutput) ReadQuery(q url.Values) (string, error) {
+	if _, ok := q["pattern"]; ok {
+		p.lock.Lock()
+		defer p.lock.Unlock()
+
+		return p.spec, nil
+	}
+
+	return "", queryError("Unsupported query " + q.Encode())
+}
+
+// parsePattern returns the steps of a pattern, or nil if value is a
+// plain level rather than a pattern
+func parsePattern(value string) ([]patternStep, error) {
+	var steps []patternStep
+	var err error
+
+	switch {
+	case strings.HasPrefix(value, blinkPrefix):
+		steps, err = parseBlink(strings.TrimPrefix(value, blinkPrefix))
+	case strings.HasPrefix(value, pwmPrefix):
+		steps, err = parseSoftPWM(strings.TrimPrefix(value, pwmPrefix))
+	case strings.HasPrefix(value, morsePrefix):
+		steps, err = parseMorse(strings.TrimPrefix(value, morsePrefix))
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range steps {
+		if s.d < minPatternStep {
+			return nil, fmt.Errorf("Pattern step too short (%v), minimum %v", s.d, minPatternStep)
+		}
+	}
+
+	return steps, nil
+}
+
+func parseBlink(spec string) ([]patternStep, error) {
+	parts := strings.Split(spec, "/")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("Can't parse blink, expected ON/OFF durations: %v", spec)
+	}
+
+	on, err := time.ParseDuration(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	off, err := time.ParseDuration(parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return []patternStep{{true, on}, {false, off}}, nil
+}
+
+func parseSoftPWM(spec string) ([]patternStep, error) {
+	parts := strings.Split(spec, "@")
+	if len(parts) != 2 || !strings.HasSuffix(parts[0], "%") || !strings.HasSuffix(parts[1], "Hz") {
+		return nil, fmt.Errorf("Can't parse pwm, expected DUTY%%@FREQHz: %v", spec)
+	}
+
+	duty, err := strconv.ParseFloat(strings.TrimSuffix(parts[0], "%"), 64)
+	if err != nil || duty <= 0 || duty >= 100 {
+		return nil, fmt.Errorf("Duty cycle must be between 0%% and 100%%: %v", parts[0])
+	}
+
+	freq, err := strconv.ParseFloat(strings.TrimSuffix(parts[1], "Hz"), 64)
+	if err != nil || freq <= 0 || freq > maxSoftPWMFreq {
+		return nil, fmt.Errorf("Frequency must be above 0Hz and at most %vHz: %v", maxSoftPWMFreq, parts[1])
+	}
+
+	period := time.Duration(float64(time.Second) / freq)
+	on := time.Duration(float64(period) * duty / 100)
+
+	return []patternStep{{true, on}, {false, period - on}}, nil
+}
+
+func parseMorse(spec string) ([]patternStep, error) {
+	unit := defaultMorseUnit
+	if i := strings.LastIndex(spec, "@"); i >= 0 {
+		var err error
+		if unit, err = time.ParseDuration(spec[i+1:]); err != nil {
+			return nil, err
+		}
+		spec = spec[:i]
+	}
+
+	var steps []patternStep
+	// add appends a step, merging it with the previous one if they
+	// have the same level
+	add := func(level bool, units int) {
+		d := unit * time.Duration(units)
+		if n := len(steps); n > 0 && steps[n-1].level == level {
+			steps[n-1].d += d
+		} else {
+			steps = append(steps, patternStep{level, d})
+		}
+	}
+
+	for _, c := range spec {
+		switch c {
+		case '.':
+			add(true, 1)
+			add(false, 1)
+		case '-':
+			add(true, 3)
+			add(false, 1)
+		case ' ':
+			add(false, 2)
+		default:
+			return nil, fmt.Errorf("Unexpected %q in morse pattern, expected '.', '-' or ' '", c)
+		}
+	}
+
+	if len(steps) == 0 || !steps[0].level {
+		return nil, fmt.Errorf("Morse pattern must start with a dot or dash")
+	}
+	add(false, 6)
+
+	return steps, nil
+}
+
+func (p *PatternedOutput) patternControl(v <-chan patternRequest) {
+	// Create a stopped timer, ready to use when a pattern starts
+	t := time.NewTimer(time.Hour)
+	if !t.Stop() {
+		<-t.C
+	}
+	// running allows us to determine whether the timer
+	// should be stopped before resetting, to prevent a race
+	running := false
+
+	var steps []patternStep
+	step := 0
+
+	for {
+		select {
+		case req := <-v: // New level or pattern to set
+			if running && !t.Stop() {
+				<-t.C
+			}
+
+			level := req.level
+			if req.steps != nil {
+				level = req.steps[0].level
+			}
+
+			// Any previous pattern has stopped, whether or not the
+			// new level can be written
+			running = false
+			p.setSpec("")
+			p.setFault(nil)
+
+			if err := p.WriteBool(level); err != nil {
+				req.result <- err
+				continue
+			}
+
+			steps, step = req.steps, 0
+			if steps != nil {
+				t.Reset(steps[0].d)
+				running = true
+				p.setSpec(req.spec)
+			}
+			req.result <- nil
+
+		case <-t.C: // Move on to the next step of the pattern
+			step = (step + 1) % len(steps)
+			if err := p.WriteBool(steps[step].level); err != nil {
+				if p.Fault() == nil {
+					fmt.Println("Pattern step failed:", err)
+				}
+				p.setFault(fmt.Errorf("Pattern step failed at %v: %v", time.Now().Format(time.RFC3339), err))
+			}
+			t.Reset(steps[step].d)
+		}
+	}
+}
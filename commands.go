@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mhp/tacoma/driver"
+	"github.com/mhp/tacoma/gpiochip"
+)
+
+// command is a subcommand selected by the first program argument
+type command struct {
+	args string
+	help string
+	run  func(args []string)
+}
+
+var commands map[string]command
+
+// commands is filled in by init, since usage refers back to it
+func init() {
+	commands = map[string]command{
+		"config":  {"[config.json]", "print the effective configuration after includes and overlays", configCmd},
+		"drivers": {"", "list the available pin drivers and the pin names they accept", driversCmd},
+		"gpio":    {"list", "list every gpio chip and line, and how they are configured", gpioCmd},
+	}
+}
+
+func usage() {
+	fmt.Println("Usage:", os.Args[0], "[config.json]")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		cmd := commands[name]
+		fmt.Printf("       %v %v %v\n\t%v\n", os.Args[0], name, cmd.args, cmd.help)
+	}
+
+	fmt.Println("A config file with the same name as a command is served rather than running the command.")
+}
+
+// configFileArg returns the config file named in args, or the default
+func configFileArg(args []string) string {
+	if len(args) > 1 {
+		usage()
+		os.Exit(1)
+	}
+
+	if len(args) == 1 {
+		return args[0]
+	}
+	return defaultConfigFile
+}
+
+func configCmd(args []string) {
+	cfg, err := loadConfig(configFileArg(args))
+	if err != nil {
+		fmt.Println("Error reading config:", err)
+		os.Exit(1)
+	}
+
+	out, err := json.MarshalIndent(cfg, "", "\t")
+	if err != nil {
+		fmt.Println("Error formatting config:", err)
+		os.Exit(1)
+	}
+
+	fmt.Println(string(out))
+}
+
+func driversCmd(args []string) {
+	if len(args) != 0 {
+		usage()
+		os.Exit(1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "DRIVER\tPIN NAMES\tCAPABILITIES")
+	for _, d := range driver.Drivers() {
+		fmt.Fprintf(w, "%v\t%v\t%v\n", d.Name, d.Syntax, strings.Join(d.Capabilities, ", "))
+	}
+	w.Flush()
+}
+
+func gpioCmd(args []string) {
+	if len(args) != 1 || args[0] != "list" {
+		usage()
+		os.Exit(1)
+	}
+
+	chips, err := gpiochip.Enumerate()
+	if err != nil {
+		fmt.Println("Error enumerating gpio chips:", err)
+		os.Exit(1)
+	}
+
+	if len(chips) == 0 {
+		fmt.Println("No gpio chips found")
+		return
+	}
+
+	for _, c := range chips {
+		fmt.Printf("%v [%v] (%v lines)\n", c.Chip, c.Label, len(c.Lines))
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		for _, l := range c.Lines {
+			polarity := "active-high"
+			if l.ActiveLow {
+				polarity = "active-low"
+			}
+
+			used := ""
+			if l.Used {
+				used = "[used]"
+			}
+
+			fmt.Fprintf(w, "\tline %v:\t%q\t%q\t%v\t%v\t%v\t%v\t%v\n",
+				l.Offset, l.Name, l.Consumer, l.Direction, polarity, l.Drive, l.Bias, used)
+		}
+		w.Flush()
+	}
+}
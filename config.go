@@ -1,8 +1,11 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"path/filepath"
 )
 
 type ConfigFile struct {
@@ -10,10 +13,13 @@ type ConfigFile struct {
 	ClientConfig ClientConfig
 	Inputs       map[string]Input
 	Outputs      map[string]Output
+	Drivers      map[string]json.RawMessage `json:",omitempty"`
 }
 
 type ServerConfig struct {
 	ListenAddress string
+	// HistoryDir holds the logged readings of inputs
+	HistoryDir string
 }
 
 type ClientConfig struct {
@@ -21,37 +27,189 @@ type ClientConfig struct {
 }
 
 type Input struct {
-	Pin       string
-	Hidden    bool
-	Invert    bool
-	OnRising  string
-	OnFalling string
-	Method    string
-	Payload   string
-	Debounce  string
+	Pin        string
+	Hidden     bool
+	Invert     bool
+	OnRising   string
+	OnFalling  string
+	Method     string
+	Payload    string
+	Debounce   string
+	Bias       string
+	FullScale  float64
+	SampleRate int
+	Alert      string
+	// High, Low and Hysteresis are in the units of any Scaling, or in
+	// raw counts as given by ?raw without one
+	High         *float64
+	Low          *float64
+	Hysteresis   float64
+	SamplePeriod string
+	Filter       string
+	FilterLength int
+	LogPeriod    string
+	Scaling      *Scaling
+	Units        string
+	Precision    *int
 }
 
 type Output struct {
-	Pin    string
-	Hidden bool
-	Invert bool
-	Pulse  string
+	Pin              string
+	Hidden           bool
+	Invert           bool
+	Pulse            string
+	PulseMin         string
+	PulseMax         string
+	PulseMinOff      string
+	PulseNoRetrigger bool
+	PulseLow         bool
+	// Patterns lets a digital output accept blink, pwm and morse
+	// patterns as well as levels
+	Patterns bool
+	Drive    string
+	Period   string
 }
 
-func loadConfig(file string) (ConfigFile, error) {
-	data, err := ioutil.ReadFile(file)
-	if err != nil {
-		return ConfigFile{}, err
-	}
+// configLayer is the on-disk form of a config file.  Sections are
+// kept raw so that each layer can be merged field by field on top
+// of whatever has been loaded before it.
+//
+// Include lists files loaded before this one, so this file can
+// override them.  Overlays lists files applied after this one, so
+// they can override it.  Within Inputs and Outputs, an entry whose
+// value is null removes that entry from the merged configuration.
+// Driver blocks are opaque, so a later block replaces an earlier one.
+type configLayer struct {
+	Include      []string
+	Overlays     []string
+	ServerConfig json.RawMessage
+	ClientConfig json.RawMessage
+	Inputs       map[string]json.RawMessage
+	Outputs      map[string]json.RawMessage
+	Drivers      map[string]json.RawMessage
+}
 
+func loadConfig(file string) (ConfigFile, error) {
 	myConfig := ConfigFile{
 		ServerConfig: ServerConfig{
 			ListenAddress: "127.0.0.1:8080",
+			HistoryDir:    "/var/lib/tacoma/history",
 		},
+		Inputs:  make(map[string]Input),
+		Outputs: make(map[string]Output),
 	}
-	if err := json.Unmarshal(data, &myConfig); err != nil {
+
+	if err := mergeConfig(&myConfig, file, nil); err != nil {
 		return ConfigFile{}, err
 	}
 
 	return myConfig, nil
 }
+
+// mergeConfig applies file (and anything it includes or overlays) on
+// top of cfg.  stack holds the files currently being merged, so that
+// include loops can be reported rather than recursing forever.
+func mergeConfig(cfg *ConfigFile, file string, stack []string) error {
+	for _, f := range stack {
+		if f == file {
+			return fmt.Errorf("%v: config includes itself", file)
+		}
+	}
+	stack = append(stack, file)
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	var layer configLayer
+	if err := json.Unmarshal(data, &layer); err != nil {
+		return fmt.Errorf("%v: %v", file, err)
+	}
+
+	for _, inc := range layer.Include {
+		if err := mergeConfig(cfg, relativeTo(file, inc), stack); err != nil {
+			return err
+		}
+	}
+
+	if err := mergeLayer(cfg, layer); err != nil {
+		return fmt.Errorf("%v: %v", file, err)
+	}
+
+	for _, ovl := range layer.Overlays {
+		if err := mergeConfig(cfg, relativeTo(file, ovl), stack); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mergeLayer merges the sections of a single layer into cfg
+func mergeLayer(cfg *ConfigFile, layer configLayer) error {
+	if layer.ServerConfig != nil {
+		if err := json.Unmarshal(layer.ServerConfig, &cfg.ServerConfig); err != nil {
+			return fmt.Errorf("ServerConfig: %v", err)
+		}
+	}
+
+	if layer.ClientConfig != nil {
+		if err := json.Unmarshal(layer.ClientConfig, &cfg.ClientConfig); err != nil {
+			return fmt.Errorf("ClientConfig: %v", err)
+		}
+	}
+
+	for name, raw := range layer.Inputs {
+		if isNull(raw) {
+			delete(cfg.Inputs, name)
+			continue
+		}
+
+		in := cfg.Inputs[name]
+		if err := json.Unmarshal(raw, &in); err != nil {
+			return fmt.Errorf("input %v: %v", name, err)
+		}
+		cfg.Inputs[name] = in
+	}
+
+	for name, raw := range layer.Outputs {
+		if isNull(raw) {
+			delete(cfg.Outputs, name)
+			continue
+		}
+
+		out := cfg.Outputs[name]
+		if err := json.Unmarshal(raw, &out); err != nil {
+			return fmt.Errorf("output %v: %v", name, err)
+		}
+		cfg.Outputs[name] = out
+	}
+
+	for name, raw := range layer.Drivers {
+		if isNull(raw) {
+			delete(cfg.Drivers, name)
+			continue
+		}
+
+		if cfg.Drivers == nil {
+			cfg.Drivers = make(map[string]json.RawMessage)
+		}
+		cfg.Drivers[name] = raw
+	}
+
+	return nil
+}
+
+func isNull(raw json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+}
+
+// relativeTo resolves name relative to the directory holding file,
+// unless name is already absolute
+func relativeTo(file, name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(filepath.Dir(file), name)
+}
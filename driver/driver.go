@@ -0,0 +1,96 @@
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Driver describes a pin backend.  Backends register themselves from
+// an init function, and pins are created by the driver whose Prefix
+// is the longest match for the pin name.
+type Driver struct {
+	// Name identifies the driver, and selects its block in the
+	// Drivers section of the config file
+	Name string
+	// Prefix is matched against the start of pin names
+	Prefix string
+	// Syntax describes the pin names the driver accepts
+	Syntax string
+	// Capabilities lists what the driver's pins can be used for
+	Capabilities []string
+
+	// Create makes a pin from its name
+	Create func(name string) (interface{}, error)
+	// Configure, if not nil, is passed the driver's config block
+	// before any pins are created
+	Configure func(cfg json.RawMessage) error
+}
+
+var drivers = make(map[string]Driver)
+
+// Register makes a driver available.  It panics if the name is
+// already taken, since that is a programming error.
+func Register(d Driver) {
+	if _, ok := drivers[d.Name]; ok {
+		panic("driver: duplicate registration of " + d.Name)
+	}
+	drivers[d.Name] = d
+}
+
+// Drivers returns all registered drivers, sorted by name
+func Drivers() []Driver {
+	ds := make([]Driver, 0, len(drivers))
+	for _, d := range drivers {
+		ds = append(ds, d)
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i].Name < ds[j].Name })
+	return ds
+}
+
+// Lookup finds the driver responsible for a pin name
+func Lookup(name string) (Driver, bool) {
+	var best Driver
+	found := false
+
+	for _, d := range drivers {
+		if strings.HasPrefix(name, d.Prefix) && (!found || len(d.Prefix) > len(best.Prefix)) {
+			best = d
+			found = true
+		}
+	}
+
+	return best, found
+}
+
+// CreatePin makes a pin using whichever driver recognises its name
+func CreatePin(name string) (interface{}, error) {
+	d, ok := Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("Unknown pin type: %v", name)
+	}
+
+	return d.Create(name)
+}
+
+// Configure passes each driver its block from cfg, which is indexed
+// by driver name
+func Configure(cfg map[string]json.RawMessage) error {
+	for name, block := range cfg {
+		d, ok := drivers[name]
+		if !ok {
+			return fmt.Errorf("Unknown driver: %v", name)
+		}
+
+		if d.Configure == nil {
+			return fmt.Errorf("Driver %v has no configuration", name)
+		}
+
+		if err := d.Configure(block); err != nil {
+			return fmt.Errorf("Driver %v: %v", name, err)
+		}
+	}
+
+	return nil
+}
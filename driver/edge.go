@@ -0,0 +1,12 @@
+package driver
+
+import (
+	"time"
+)
+
+// Edge is a transition reported by a triggering pin.  Time is used to
+// order edges from several pins that were noticed at the same wakeup.
+type Edge struct {
+	Rising bool
+	Time   time.Time
+}
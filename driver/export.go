@@ -0,0 +1,34 @@
+package driver
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// exportTimeout is how long to wait for the kernel (and udev, which
+// may need to fix up permissions) after exporting from sysfs
+const exportTimeout = time.Second
+
+// Export asks a sysfs class for item n by writing to its export file,
+// then waits until the ready file is writable.  This is how the legacy
+// gpio and pwm classes hand out lines and channels.
+func Export(dir string, n int, ready string) error {
+	if err := ioutil.WriteFile(filepath.Join(dir, "export"), []byte(strconv.Itoa(n)), 0644); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(exportTimeout)
+	for {
+		err := syscall.Access(ready, 2 /* W_OK */)
+		if err == nil {
+			return nil
+		} else if time.Now().After(deadline) {
+			return err
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,102 @@
+package driver
+
+import (
+	"syscall"
+	"time"
+)
+
+// Settler debounces a line in userspace.  Every change notification
+// restarts a timer, and only once the line has been quiet for the
+// debounce period is it read again.  An edge is reported if that stable
+// level differs from the last one reported, so the final state is always
+// right however much the line bounced on the way there.
+//
+// The line's notification fd and the timer share a private epoll
+// instance, which is itself pollable and so can be handed to Triggers
+// like any other event fd.
+type Settler struct {
+	epfd    int
+	timerFd int
+	fd      int
+	read    func() (bool, error)
+	ack     func()
+	level   bool
+	rising  bool // report rising edges
+	falling bool // report falling edges
+}
+
+// NewSettler watches fd for events, which ack must consume, and reads
+// the line with read once it has settled
+func NewSettler(fd int, events uint32, read func() (bool, error), ack func(), onRising, onFalling bool) (*Settler, error) {
+	level, err := read()
+	if err != nil {
+		return nil, err
+	}
+
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+
+	tfd, err := TimerfdCreate()
+	if err != nil {
+		syscall.Close(epfd)
+		return nil, err
+	}
+
+	for _, ev := range []syscall.EpollEvent{
+		{Events: events, Fd: int32(fd)},
+		{Events: syscall.EPOLLIN, Fd: int32(tfd)},
+	} {
+		ev := ev
+		if err := syscall.EpollCtl(epfd, syscall.EPOLL_CTL_ADD, int(ev.Fd), &ev); err != nil {
+			syscall.Close(epfd)
+			syscall.Close(tfd)
+			return nil, err
+		}
+	}
+
+	return &Settler{epfd, tfd, fd, read, ack, level, onRising, onFalling}, nil
+}
+
+// Fd is the fd to poll for the settler being ready
+func (s *Settler) Fd() int {
+	return s.epfd
+}
+
+// IdentifyEdges handles whatever woke the poller, restarting the settle
+// time for a change, or reporting an edge once settled
+func (s *Settler) IdentifyEdges(debounce time.Duration) []Edge {
+	events := make([]syscall.EpollEvent, 2)
+
+	n, err := syscall.EpollWait(s.epfd, events, 0)
+	if err != nil {
+		return nil
+	}
+
+	var edges []Edge
+	for _, ev := range events[:n] {
+		switch int(ev.Fd) {
+		case s.fd:
+			// Discard the change itself, just restart the settle time
+			s.ack()
+			TimerfdArm(s.timerFd, debounce)
+
+		case s.timerFd:
+			buf := make([]byte, 8)
+			syscall.Read(s.timerFd, buf)
+
+			level, err := s.read()
+			if err != nil || level == s.level {
+				continue
+			}
+
+			s.level = level
+			if (level && s.rising) || (!level && s.falling) {
+				edges = append(edges, Edge{Rising: level, Time: time.Now()})
+			}
+		}
+	}
+
+	return edges
+}
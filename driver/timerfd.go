@@ -0,0 +1,38 @@
+package driver
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Timerfds let drivers wait for a line to settle from within epoll,
+// alongside the line itself.
+
+// itimerspec mirrors struct itimerspec for timerfd_settime
+type itimerspec struct {
+	interval syscall.Timespec
+	value    syscall.Timespec
+}
+
+// clockMonotonic is CLOCK_MONOTONIC from <linux/time.h>
+const clockMonotonic = 1
+
+// TimerfdCreate makes a timerfd, which is readable once it has expired
+func TimerfdCreate() (int, error) {
+	fd, _, errno := syscall.Syscall(syscall.SYS_TIMERFD_CREATE, uintptr(clockMonotonic), uintptr(syscall.O_CLOEXEC), 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+// TimerfdArm starts a one-shot timer, replacing any running one
+func TimerfdArm(fd int, d time.Duration) error {
+	spec := itimerspec{value: syscall.NsecToTimespec(d.Nanoseconds())}
+
+	if _, _, errno := syscall.Syscall6(syscall.SYS_TIMERFD_SETTIME, uintptr(fd), 0, uintptr(unsafe.Pointer(&spec)), 0, 0, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
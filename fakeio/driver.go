@@ -0,0 +1,40 @@
+package fakeio
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/mhp/tacoma/driver"
+)
+
+type config struct {
+	// Interval is how often fake inputs toggle
+	Interval string
+}
+
+func init() {
+	driver.Register(driver.Driver{
+		Name:         "fakeio",
+		Prefix:       "fakeio",
+		Syntax:       "fakeio<anything> (simulated pin, logs all activity)",
+		Capabilities: []string{"digital input", "digital output", "edge triggers", "bias", "drive modes"},
+		Create: func(name string) (interface{}, error) {
+			return CreatePin(name)
+		},
+		Configure: func(raw json.RawMessage) error {
+			var cfg config
+			if err := json.Unmarshal(raw, &cfg); err != nil {
+				return err
+			}
+
+			if cfg.Interval != "" {
+				d, err := time.ParseDuration(cfg.Interval)
+				if err != nil {
+					return err
+				}
+				toggleInterval = d
+			}
+			return nil
+		},
+	})
+}
@@ -2,11 +2,15 @@ package fakeio
 
 import (
 	"fmt"
-	"strings"
 	"syscall"
 	"time"
+
+	"github.com/mhp/tacoma/driver"
 )
 
+// toggleInterval is how often fake inputs change state
+var toggleInterval = 2 * time.Second
+
 type Pin struct {
 	Name string
 	high bool
@@ -27,6 +31,36 @@ func (p *Pin) SetActiveLow() error {
 	return nil
 }
 
+func (p *Pin) SetPullUp() error {
+	fmt.Println(p.Name, "bias --> pull-up")
+	return nil
+}
+
+func (p *Pin) SetPullDown() error {
+	fmt.Println(p.Name, "bias --> pull-down")
+	return nil
+}
+
+func (p *Pin) SetBiasDisabled() error {
+	fmt.Println(p.Name, "bias --> disabled")
+	return nil
+}
+
+func (p *Pin) SetPushPull() error {
+	fmt.Println(p.Name, "drive --> push-pull")
+	return nil
+}
+
+func (p *Pin) SetOpenDrain() error {
+	fmt.Println(p.Name, "drive --> open-drain")
+	return nil
+}
+
+func (p *Pin) SetOpenSource() error {
+	fmt.Println(p.Name, "drive --> open-source")
+	return nil
+}
+
 func (p *Pin) SetDebounce(d time.Duration) error {
 	fmt.Println(p.Name, "set debounce to", d)
 	return nil
@@ -52,7 +86,7 @@ func (p *Pin) GetEpollEvent(r, f bool) (*syscall.EpollEvent, error) {
 	}
 
 	go func(fd int) {
-		t := time.NewTicker(2 * time.Second)
+		t := time.NewTicker(toggleInterval)
 		buf := make([]byte, 1)
 
 		for _ = range t.C {
@@ -65,22 +99,14 @@ func (p *Pin) GetEpollEvent(r, f bool) (*syscall.EpollEvent, error) {
 	return &syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(pipes[0])}, nil
 }
 
-func (p *Pin) IdentifyEdge(e *syscall.EpollEvent) (r, f bool) {
+func (p *Pin) IdentifyEdges(e *syscall.EpollEvent) ([]driver.Edge, int) {
 	// First, read from the pipe to drain it
 	buf := make([]byte, 1)
 	syscall.Read(int(e.Fd), buf)
 
 	p.high = !p.high
 
-	if p.high {
-		return true, false
-	}
-
-	return false, true
-}
-
-func RecognisePin(name string) bool {
-	return strings.HasPrefix(name, "fakeio")
+	return []driver.Edge{{Rising: p.high, Time: time.Now()}}, 0
 }
 
 func CreatePin(name string) (*Pin, error) {
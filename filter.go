@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// defaultFilterLength is the number of samples filtered when not given
+const defaultFilterLength = 8
+
+// filter smooths a series of readings.  add takes each reading in turn
+// and gives the filtered value.
+type filter interface {
+	add(v int) int
+}
+
+// newFilter makes a filter of the kind named in the config, or nil if
+// none is named
+func newFilter(kind string, length int) (filter, error) {
+	if length == 0 {
+		length = defaultFilterLength
+	} else if length < 1 {
+		return nil, fmt.Errorf("Bad filter length %v", length)
+	}
+
+	switch kind {
+	case "":
+		return nil, nil
+	case "average":
+		return &averageFilter{window: newWindow(length)}, nil
+	case "median":
+		return &medianFilter{window: newWindow(length)}, nil
+	case "ema":
+		// Weighted to have the same centre of mass as an average
+		// over the same length
+		return &emaFilter{alpha: 2 / float64(length+1)}, nil
+	}
+
+	return nil, fmt.Errorf("Unknown filter %q (expected average, median or ema)", kind)
+}
+
+// window holds the most recent readings
+type window struct {
+	samples []int
+	next    int
+	full    bool
+}
+
+func newWindow(length int) window {
+	return window{samples: make([]int, length)}
+}
+
+func (w *window) push(v int) {
+	w.samples[w.next] = v
+	w.next++
+	if w.next == len(w.samples) {
+		w.next, w.full = 0, true
+	}
+}
+
+// contents gives the readings held, in no particular order
+func (w *window) contents() []int {
+	if w.full {
+		return w.samples
+	}
+	return w.samples[:w.next]
+}
+
+type averageFilter struct {
+	window
+}
+
+func (f *averageFilter) add(v int) int {
+	f.push(v)
+
+	sum := 0
+	samples := f.contents()
+	for _, s := range samples {
+		sum += s
+	}
+
+	// Round to the nearest, rather than towards zero
+	n := len(samples)
+	if sum < 0 {
+		return (sum - n/2) / n
+	}
+	return (sum + n/2) / n
+}
+
+type medianFilter struct {
+	window
+}
+
+func (f *medianFilter) add(v int) int {
+	f.push(v)
+
+	sorted := append([]int(nil), f.contents()...)
+	sort.Ints(sorted)
+
+	return sorted[len(sorted)/2]
+}
+
+type emaFilter struct {
+	alpha  float64
+	value  float64
+	primed bool
+}
+
+func (f *emaFilter) add(v int) int {
+	if !f.primed {
+		f.value, f.primed = float64(v), true
+	} else {
+		f.value += f.alpha * (float64(v) - f.value)
+	}
+
+	if f.value < 0 {
+		return int(f.value - 0.5)
+	}
+	return int(f.value + 0.5)
+}
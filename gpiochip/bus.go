@@ -0,0 +1,170 @@
+package gpiochip
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Bus is a group of lines on one chip which are read and written
+// together, as a binary number with the first line as the least
+// significant bit
+type Bus struct {
+	chip    int
+	offsets []int
+	fd      int
+	v1      bool
+	flags   uint64
+}
+
+func (b *Bus) SetInput() error {
+	return b.twiddleFlags(GPIO_V2_LINE_FLAG_INPUT, GPIO_V2_LINE_FLAG_OUTPUT)
+}
+
+func (b *Bus) SetOutput() error {
+	return b.twiddleFlags(GPIO_V2_LINE_FLAG_OUTPUT, GPIO_V2_LINE_FLAG_INPUT)
+}
+
+func (b *Bus) SetActiveLow() error {
+	return b.twiddleFlags(GPIO_V2_LINE_FLAG_ACTIVE_LOW, 0)
+}
+
+func (b *Bus) Width() int {
+	return len(b.offsets)
+}
+
+func (b *Bus) mask() uint64 {
+	return uint64(1)<<uint(len(b.offsets)) - 1
+}
+
+func (b *Bus) ReadBits() (uint64, error) {
+	if !b.v1 {
+		return GetLineValuesV2(b.fd, b.mask())
+	}
+
+	values, err := ReadLines(b.fd, len(b.offsets))
+	if err != nil {
+		return 0, err
+	}
+
+	bits := uint64(0)
+	for i, v := range values {
+		if v != 0 {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+func (b *Bus) WriteBits(bits uint64) error {
+	if !b.v1 {
+		return SetLineValuesV2(b.fd, b.mask(), bits)
+	}
+
+	values := make([]uint8, len(b.offsets))
+	for i := range values {
+		values[i] = uint8(bits>>uint(i)) & 1
+	}
+	return WriteLines(b.fd, values)
+}
+
+func (b *Bus) twiddleFlags(set, clear uint64) error {
+	b.flags = b.flags &^ clear
+	b.flags = b.flags | set
+
+	if !b.v1 {
+		return SetLineConfigV2(b.fd, len(b.offsets), LineConfig{Flags: b.flags})
+	}
+
+	cfd, err := getFdForController(b.chip)
+	if err != nil {
+		return err
+	}
+
+	if b.fd >= 0 {
+		syscall.Close(b.fd)
+	}
+
+	handleFlags, _ := v1Flags(b.flags)
+	b.fd, err = GetLinesFd(cfd, b.offsets, handleFlags)
+	return err
+}
+
+// isBus reports whether a gpiochipN:... name lists more than one line
+func isBus(name string) bool {
+	if !strings.HasPrefix(name, pinPrefix) {
+		return false
+	}
+
+	// Labels may contain '-', but gpiochip:LABEL:NAME has no chip number
+	parts := strings.SplitN(strings.TrimPrefix(name, pinPrefix), ":", 2)
+	return len(parts) == 2 && parts[0] != "" && strings.ContainsAny(parts[1], ",-")
+}
+
+// CreateBus accepts gpiochipN:L, where L is a comma separated list of
+// line offsets or ranges of offsets, such as gpiochip0:4-7 or gpiochip0:9,3
+func CreateBus(name string) (*Bus, error) {
+	parts := strings.Split(strings.TrimPrefix(name, pinPrefix), ":")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("Can't parse bus lines: %v", name)
+	}
+
+	chip, err := strconv.ParseUint(parts[0], 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("Can't parse bus chip number: %v", name)
+	}
+
+	offsets, err := parseOffsets(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("Can't parse bus lines %v: %v", name, err)
+	}
+
+	cfd, err := getFdForController(int(chip))
+	if err != nil {
+		return nil, fmt.Errorf("Can't get fd for bus %v: %v", name, err)
+	}
+
+	fd, v1, err := requestLines(cfd, offsets)
+	if err != nil {
+		return nil, fmt.Errorf("Can't get line fd for bus %v: %v", name, err)
+	}
+
+	return &Bus{chip: int(chip), offsets: offsets, fd: fd, v1: v1}, nil
+}
+
+func parseOffsets(list string) ([]int, error) {
+	var offsets []int
+	seen := make(map[int]bool)
+
+	for _, item := range strings.Split(list, ",") {
+		bounds := strings.SplitN(item, "-", 2)
+
+		first, err := strconv.ParseUint(bounds[0], 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("bad offset %q", item)
+		}
+		last := first
+
+		if len(bounds) == 2 {
+			last, err = strconv.ParseUint(bounds[1], 10, 8)
+			if err != nil || last < first {
+				return nil, fmt.Errorf("bad range %q", item)
+			}
+		}
+
+		for o := int(first); o <= int(last); o++ {
+			if seen[o] {
+				return nil, fmt.Errorf("line %v listed twice", o)
+			}
+			seen[o] = true
+			offsets = append(offsets, o)
+		}
+	}
+
+	if len(offsets) > GPIO_V2_LINES_MAX {
+		return nil, fmt.Errorf("too many lines (%v>%v)", len(offsets), GPIO_V2_LINES_MAX)
+	}
+
+	return offsets, nil
+}
@@ -0,0 +1,21 @@
+package gpiochip
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// clockMonotonic is CLOCK_MONOTONIC from <linux/time.h>
+const clockMonotonic = 1
+
+// monotonicTime converts a CLOCK_MONOTONIC timestamp, as used for v2
+// events, into wall clock time so it can be compared with other pins
+func monotonicTime(ns uint64) time.Time {
+	var now syscall.Timespec
+	if _, _, errno := syscall.Syscall(syscall.SYS_CLOCK_GETTIME, uintptr(clockMonotonic), uintptr(unsafe.Pointer(&now)), 0); errno != 0 {
+		return time.Now()
+	}
+
+	return time.Now().Add(-time.Duration(now.Nano() - int64(ns)))
+}
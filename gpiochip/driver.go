@@ -0,0 +1,49 @@
+package gpiochip
+
+import (
+	"encoding/json"
+
+	"github.com/mhp/tacoma/driver"
+)
+
+type config struct {
+	// Consumer is the label the kernel reports for lines we hold
+	Consumer string
+}
+
+var capabilities = []string{"digital input", "digital output", "edge triggers", "bias", "drive modes"}
+
+func init() {
+	driver.Register(driver.Driver{
+		Name:         "gpiochip",
+		Prefix:       pinPrefix,
+		Syntax:       "gpiochipN:M (chip number N, line offset M), gpiochip:LABEL:NAME (line NAME on chip LABEL) or gpiochipN:M-P,Q (bus of lines, first is least significant)",
+		Capabilities: append(capabilities, "multi-line bus"),
+		Create: func(name string) (interface{}, error) {
+			if isBus(name) {
+				return CreateBus(name)
+			}
+			return CreatePin(name)
+		},
+		Configure: func(raw json.RawMessage) error {
+			cfg := config{Consumer: ConsumerString}
+			if err := json.Unmarshal(raw, &cfg); err != nil {
+				return err
+			}
+
+			ConsumerString = cfg.Consumer
+			return nil
+		},
+	})
+
+	// Line names live in the same driver, but read better with their own prefix
+	driver.Register(driver.Driver{
+		Name:         "gpio",
+		Prefix:       namePrefix,
+		Syntax:       "gpio:NAME (line NAME, searched for on every chip)",
+		Capabilities: capabilities,
+		Create: func(name string) (interface{}, error) {
+			return CreatePin(name)
+		},
+	})
+}
@@ -38,6 +38,10 @@ const (
 	GPIOLINE_FLAG_ACTIVE_LOW  = (1 << 2)
 	GPIOLINE_FLAG_OPEN_DRAIN  = (1 << 3)
 	GPIOLINE_FLAG_OPEN_SOURCE = (1 << 4)
+	// Bias flags were added in kernel version 5.5
+	GPIOLINE_FLAG_BIAS_PULL_UP   = (1 << 5)
+	GPIOLINE_FLAG_BIAS_PULL_DOWN = (1 << 6)
+	GPIOLINE_FLAG_BIAS_DISABLE   = (1 << 7)
 )
 
 /**
@@ -69,6 +73,10 @@ const (
 	GPIOHANDLE_REQUEST_ACTIVE_LOW  = (1 << 2)
 	GPIOHANDLE_REQUEST_OPEN_DRAIN  = (1 << 3)
 	GPIOHANDLE_REQUEST_OPEN_SOURCE = (1 << 4)
+	// Bias flags were added in kernel version 5.5
+	GPIOHANDLE_REQUEST_BIAS_PULL_UP   = (1 << 5)
+	GPIOHANDLE_REQUEST_BIAS_PULL_DOWN = (1 << 6)
+	GPIOHANDLE_REQUEST_BIAS_DISABLE   = (1 << 7)
 )
 
 /**
@@ -171,3 +179,239 @@ var (
 	GPIO_GET_LINEHANDLE_IOCTL = _IOWR(0xB4, 0x03, unsafe.Sizeof(gpiohandle_request{}))
 	GPIO_GET_LINEEVENT_IOCTL  = _IOWR(0xB4, 0x04, unsafe.Sizeof(gpioevent_request{}))
 )
+
+// Constants and structures for the v2 uAPI, copied from include/uapi/linux/gpio.h
+// of kernel version 5.10 and converted in the same way as above
+
+/*
+ * The maximum size of name and label arrays.
+ *
+ * Must be a multiple of 8 to ensure 32/64-bit alignment of structs.
+ */
+const GPIO_MAX_NAME_SIZE = 32
+
+/*
+ * Maximum number of requested lines.
+ *
+ * Must be no greater than 64, as bitmaps are restricted here to 64-bits
+ * for simplicity, and a multiple of 2 to ensure 32/64-bit alignment of
+ * structs.
+ */
+const GPIO_V2_LINES_MAX = 64
+
+/*
+ * The maximum number of configuration attributes associated with a line
+ * request.
+ */
+const GPIO_V2_LINE_NUM_ATTRS_MAX = 10
+
+/**
+ * enum gpio_v2_line_flag - &struct gpio_v2_line_attribute.flags values
+ * @GPIO_V2_LINE_FLAG_USED: line is not available for request
+ * @GPIO_V2_LINE_FLAG_ACTIVE_LOW: line active state is physical low
+ * @GPIO_V2_LINE_FLAG_INPUT: line is an input
+ * @GPIO_V2_LINE_FLAG_OUTPUT: line is an output
+ * @GPIO_V2_LINE_FLAG_EDGE_RISING: line detects rising (inactive to active)
+ * edges
+ * @GPIO_V2_LINE_FLAG_EDGE_FALLING: line detects falling (active to
+ * inactive) edges
+ * @GPIO_V2_LINE_FLAG_OPEN_DRAIN: line is an open drain output
+ * @GPIO_V2_LINE_FLAG_OPEN_SOURCE: line is an open source output
+ * @GPIO_V2_LINE_FLAG_BIAS_PULL_UP: line has pull-up bias enabled
+ * @GPIO_V2_LINE_FLAG_BIAS_PULL_DOWN: line has pull-down bias enabled
+ * @GPIO_V2_LINE_FLAG_BIAS_DISABLED: line has bias disabled
+ */
+const (
+	GPIO_V2_LINE_FLAG_USED           = (1 << 0)
+	GPIO_V2_LINE_FLAG_ACTIVE_LOW     = (1 << 1)
+	GPIO_V2_LINE_FLAG_INPUT          = (1 << 2)
+	GPIO_V2_LINE_FLAG_OUTPUT         = (1 << 3)
+	GPIO_V2_LINE_FLAG_EDGE_RISING    = (1 << 4)
+	GPIO_V2_LINE_FLAG_EDGE_FALLING   = (1 << 5)
+	GPIO_V2_LINE_FLAG_OPEN_DRAIN     = (1 << 6)
+	GPIO_V2_LINE_FLAG_OPEN_SOURCE    = (1 << 7)
+	GPIO_V2_LINE_FLAG_BIAS_PULL_UP   = (1 << 8)
+	GPIO_V2_LINE_FLAG_BIAS_PULL_DOWN = (1 << 9)
+	GPIO_V2_LINE_FLAG_BIAS_DISABLED  = (1 << 10)
+)
+
+/**
+ * struct gpio_v2_line_values - Values of GPIO lines
+ * @bits: a bitmap containing the value of the lines, set to 1 for active
+ * and 0 for inactive.
+ * @mask: a bitmap identifying the lines to get or set, with each bit
+ * number corresponding to the index into &struct
+ * gpio_v2_line_request.offsets.
+ */
+type gpio_v2_line_values struct {
+	bits uint64
+	mask uint64
+}
+
+/**
+ * enum gpio_v2_line_attr_id - &struct gpio_v2_line_attribute.id values
+ * identifying which field of the attribute union is in use.
+ * @GPIO_V2_LINE_ATTR_ID_FLAGS: flags field is in use
+ * @GPIO_V2_LINE_ATTR_ID_OUTPUT_VALUES: values field is in use
+ * @GPIO_V2_LINE_ATTR_ID_DEBOUNCE: debounce_period_us field is in use
+ */
+const (
+	GPIO_V2_LINE_ATTR_ID_FLAGS         = 1
+	GPIO_V2_LINE_ATTR_ID_OUTPUT_VALUES = 2
+	GPIO_V2_LINE_ATTR_ID_DEBOUNCE      = 3
+)
+
+/**
+ * struct gpio_v2_line_attribute - a configurable attribute of a line
+ * @id: attribute identifier with value from &enum gpio_v2_line_attr_id
+ * @padding: reserved for future use and must be zero filled
+ * @flags: if id is %GPIO_V2_LINE_ATTR_ID_FLAGS, the flags for the GPIO
+ * line, with values from &enum gpio_v2_line_flag, such as
+ * %GPIO_V2_LINE_FLAG_ACTIVE_LOW, %GPIO_V2_LINE_FLAG_OUTPUT etc, added
+ * together.  This overrides the default flags contained in the &struct
+ * gpio_v2_line_config for the associated line.
+ * @values: if id is %GPIO_V2_LINE_ATTR_ID_OUTPUT_VALUES, a bitmap
+ * containing the values to which the lines will be set, with each bit
+ * number corresponding to the index into &struct
+ * gpio_v2_line_request.offsets.
+ * @debounce_period_us: if id is %GPIO_V2_LINE_ATTR_ID_DEBOUNCE, the
+ * desired debounce period, in microseconds
+ */
+type gpio_v2_line_attribute struct {
+	id      uint32
+	padding uint32
+	value   uint64 // C union of u64 flags, u64 values and u32 debounce_period_us
+}
+
+/**
+ * struct gpio_v2_line_config_attribute - a configuration attribute
+ * associated with one or more of the requested lines.
+ * @attr: the configurable attribute
+ * @mask: a bitmap identifying the lines to which the attribute applies,
+ * with each bit number corresponding to the index into &struct
+ * gpio_v2_line_request.offsets.
+ */
+type gpio_v2_line_config_attribute struct {
+	attr gpio_v2_line_attribute
+	mask uint64
+}
+
+/**
+ * struct gpio_v2_line_config - Configuration for GPIO lines
+ * @flags: flags for the GPIO lines, with values from &enum
+ * gpio_v2_line_flag, such as %GPIO_V2_LINE_FLAG_ACTIVE_LOW,
+ * %GPIO_V2_LINE_FLAG_OUTPUT etc, added together.  This is the default for
+ * all requested lines but may be overridden for particular lines using
+ * @attrs.
+ * @num_attrs: the number of attributes in @attrs
+ * @padding: reserved for future use and must be zero filled
+ * @attrs: the configuration attributes associated with the requested
+ * lines.  Any attribute should only be associated with a particular line
+ * once.  If an attribute is associated with a line multiple times then the
+ * first occurrence (i.e. lowest index) has precedence.
+ */
+type gpio_v2_line_config struct {
+	flags     uint64
+	num_attrs uint32
+	padding   [5]uint32
+	attrs     [GPIO_V2_LINE_NUM_ATTRS_MAX]gpio_v2_line_config_attribute
+}
+
+/**
+ * struct gpio_v2_line_request - Information about a request for GPIO lines
+ * @offsets: an array of desired lines, specified by offset index for the
+ * associated GPIO chip
+ * @consumer: a desired consumer label for the selected GPIO lines such as
+ * "my-bitbanged-relay"
+ * @config: requested configuration for the lines.
+ * @num_lines: number of lines requested in this request, i.e. the number
+ * of valid fields in the %GPIO_V2_LINES_MAX sized arrays, set to 1 to
+ * request a single line
+ * @event_buffer_size: a suggested minimum number of line events that the
+ * kernel should buffer.  This is only relevant if edge detection is
+ * enabled in the configuration. Note that this is only a suggested value
+ * and the kernel may allocate a larger buffer or cap the size of the
+ * buffer. If this field is zero then the buffer size defaults to a minimum
+ * of @num_lines * 16.
+ * @padding: reserved for future use and must be zero filled
+ * @fd: if successful this field will contain a valid anonymous file handle
+ * after a %GPIO_GET_LINE_IOCTL operation, zero or negative value means
+ * error
+ */
+type gpio_v2_line_request struct {
+	offsets           [GPIO_V2_LINES_MAX]uint32
+	consumer          [GPIO_MAX_NAME_SIZE]byte
+	config            gpio_v2_line_config
+	num_lines         uint32
+	event_buffer_size uint32
+	padding           [5]uint32
+	fd                int32
+}
+
+/**
+ * struct gpio_v2_line_info - Information about a certain GPIO line
+ * @name: the name of this GPIO line, such as the output pin of the line on
+ * the chip, a rail or a pin header name on a board, as specified by the
+ * GPIO chip, may be empty (i.e. name[0] == '\0')
+ * @consumer: a functional name for the consumer of this GPIO line as set
+ * by whatever is using it, will be empty if there is no current user but
+ * may also be empty if the consumer doesn't set this up
+ * @offset: the local offset on this GPIO chip, fill this in when
+ * requesting the line information from the kernel
+ * @num_attrs: the number of attributes in @attrs
+ * @flags: flags for this GPIO line, with values from &enum
+ * gpio_v2_line_flag, such as %GPIO_V2_LINE_FLAG_ACTIVE_LOW,
+ * %GPIO_V2_LINE_FLAG_OUTPUT etc, added together.
+ * @attrs: the configuration attributes associated with the line
+ * @padding: reserved for future use
+ */
+type gpio_v2_line_info struct {
+	name      [GPIO_MAX_NAME_SIZE]byte
+	consumer  [GPIO_MAX_NAME_SIZE]byte
+	offset    uint32
+	num_attrs uint32
+	flags     uint64
+	attrs     [GPIO_V2_LINE_NUM_ATTRS_MAX]gpio_v2_line_attribute
+	padding   [4]uint32
+}
+
+/**
+ * enum gpio_v2_line_event_id - &struct gpio_v2_line_event.id values
+ * @GPIO_V2_LINE_EVENT_RISING_EDGE: event triggered by a rising edge
+ * @GPIO_V2_LINE_EVENT_FALLING_EDGE: event triggered by a falling edge
+ */
+const (
+	GPIO_V2_LINE_EVENT_RISING_EDGE  = 1
+	GPIO_V2_LINE_EVENT_FALLING_EDGE = 2
+)
+
+/**
+ * struct gpio_v2_line_event - The actual event being pushed to userspace
+ * @timestamp_ns: best estimate of time of event occurrence, in nanoseconds.
+ * The @timestamp_ns is read from %CLOCK_MONOTONIC and is intended to allow
+ * the accurate measurement of the time between events. It does not provide
+ * the wall-clock time.
+ * @id: event identifier with value from &enum gpio_v2_line_event_id
+ * @offset: the offset of the line that triggered the event
+ * @seqno: the sequence number for this event in the sequence of events for
+ * all the lines in this line request
+ * @line_seqno: the sequence number for this event in the sequence of
+ * events on this particular line
+ * @padding: reserved for future use
+ */
+type gpio_v2_line_event struct {
+	timestamp_ns uint64
+	id           uint32
+	offset       uint32
+	seqno        uint32
+	line_seqno   uint32
+	padding      [6]uint32
+}
+
+var (
+	GPIO_V2_GET_LINEINFO_IOCTL    = _IOWR(0xB4, 0x05, unsafe.Sizeof(gpio_v2_line_info{}))
+	GPIO_V2_GET_LINE_IOCTL        = _IOWR(0xB4, 0x07, unsafe.Sizeof(gpio_v2_line_request{}))
+	GPIO_V2_LINE_SET_CONFIG_IOCTL = _IOWR(0xB4, 0x0D, unsafe.Sizeof(gpio_v2_line_config{}))
+	GPIO_V2_LINE_GET_VALUES_IOCTL = _IOWR(0xB4, 0x0E, unsafe.Sizeof(gpio_v2_line_values{}))
+	GPIO_V2_LINE_SET_VALUES_IOCTL = _IOWR(0xB4, 0x0F, unsafe.Sizeof(gpio_v2_line_values{}))
+)
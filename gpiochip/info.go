@@ -0,0 +1,106 @@
+package gpiochip
+
+import (
+	"fmt"
+)
+
+// ChipInfo describes a gpio chip and all of its lines
+type ChipInfo struct {
+	Chip  string // name of the device in /dev, eg gpiochip0
+	Name  string // kernel name of the chip
+	Label string
+	Lines []LineInfo
+}
+
+// LineInfo describes the current state of a single gpio line
+type LineInfo struct {
+	Offset    int
+	Name      string
+	Consumer  string
+	Direction string // input or output
+	ActiveLow bool
+	Drive     string // push-pull, open-drain or open-source
+	Bias      string // pull-up, pull-down, disabled or empty if unknown
+	// Used is set when the line is claimed by the kernel or
+	// any process, including this one
+	Used bool
+}
+
+// Enumerate describes every gpio chip in the system
+func Enumerate() ([]ChipInfo, error) {
+	chips, err := chipNumbers()
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]ChipInfo, 0, len(chips))
+	for _, c := range chips {
+		info, err := describeChip(c)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+func describeChip(chip int) (ChipInfo, error) {
+	cfd, err := getFdForController(chip)
+	if err != nil {
+		return ChipInfo{}, err
+	}
+
+	name, label, lines, err := GetChipInfo(cfd)
+	if err != nil {
+		return ChipInfo{}, fmt.Errorf("Can't get info for gpiochip%d: %v", chip, err)
+	}
+
+	info := ChipInfo{
+		Chip:  fmt.Sprintf("%v%d", pinPrefix, chip),
+		Name:  name,
+		Label: label,
+		Lines: make([]LineInfo, 0, lines),
+	}
+
+	for o := 0; o < lines; o++ {
+		flags, lineName, consumer, err := GetLineInfo(cfd, o)
+		if err != nil {
+			return ChipInfo{}, fmt.Errorf("Can't get info for gpiochip%d:%d: %v", chip, o, err)
+		}
+
+		line := LineInfo{
+			Offset:    o,
+			Name:      lineName,
+			Consumer:  consumer,
+			Direction: "input",
+			ActiveLow: flags&GPIOLINE_FLAG_ACTIVE_LOW != 0,
+			Drive:     "push-pull",
+			Used:      flags&GPIOLINE_FLAG_KERNEL != 0,
+		}
+
+		if flags&GPIOLINE_FLAG_IS_OUT != 0 {
+			line.Direction = "output"
+		}
+
+		switch {
+		case flags&GPIOLINE_FLAG_OPEN_DRAIN != 0:
+			line.Drive = "open-drain"
+		case flags&GPIOLINE_FLAG_OPEN_SOURCE != 0:
+			line.Drive = "open-source"
+		}
+
+		switch {
+		case flags&GPIOLINE_FLAG_BIAS_PULL_UP != 0:
+			line.Bias = "pull-up"
+		case flags&GPIOLINE_FLAG_BIAS_PULL_DOWN != 0:
+			line.Bias = "pull-down"
+		case flags&GPIOLINE_FLAG_BIAS_DISABLE != 0:
+			line.Bias = "disabled"
+		}
+
+		info.Lines = append(info.Lines, line)
+	}
+
+	return info, nil
+}
@@ -37,9 +37,20 @@ func GetLineInfo(cfd, offset int) (uint32, string, string, error) {
 }
 
 func GetLineFd(cfd, offset int, flags uint32) (int, error) {
+	return GetLinesFd(cfd, []int{offset}, flags)
+}
+
+// GetLinesFd requests several lines with the same flags using one handle
+func GetLinesFd(cfd int, offsets []int, flags uint32) (int, error) {
+	if len(offsets) == 0 || len(offsets) > GPIOHANDLES_MAX {
+		return -1, fmt.Errorf("Can't request %v lines", len(offsets))
+	}
+
 	r := gpiohandle_request{}
-	r.lineoffsets[0] = uint32(offset)
-	r.lines = 1
+	for i, o := range offsets {
+		r.lineoffsets[i] = uint32(o)
+	}
+	r.lines = uint32(len(offsets))
 	r.flags = flags
 	copy(r.consumer_label[:], ConsumerString)
 
@@ -64,21 +75,30 @@ func GetLineEventFd(cfd, offset int, flags, events uint32) (int, error) {
 	return r.fd, nil
 }
 
-func ReadEvent(fd int) (uint64, uint32, error) {
-	evSize := unsafe.Sizeof(gpioevent_data{})
-	buf := make([]byte, evSize)
+// eventBatch is how many events are read from a line at once
+const eventBatch = 16
+
+// ReadEvents reads all the queued events from a v1 event fd, up to
+// eventBatch of them.  Only Timestamp and ID are filled in.
+func ReadEvents(fd int) ([]LineEvent, error) {
+	evSize := int(unsafe.Sizeof(gpioevent_data{}))
+	buf := make([]byte, evSize*eventBatch)
 
 	n, err := syscall.Read(fd, buf)
 	if err != nil {
-		return 0, 0, err
+		return nil, err
 	}
-	if n != int(evSize) {
-		return 0, 0, fmt.Errorf("Incomplete event read %v, expected %v bytes", n, evSize)
+	if n%evSize != 0 {
+		return nil, fmt.Errorf("Incomplete event read %v, expected multiple of %v bytes", n, evSize)
 	}
 
-	r := (*gpioevent_data)(unsafe.Pointer(&buf[0]))
+	events := make([]LineEvent, 0, n/evSize)
+	for i := 0; i < n; i += evSize {
+		r := (*gpioevent_data)(unsafe.Pointer(&buf[i]))
+		events = append(events, LineEvent{Timestamp: r.timestamp, ID: r.id})
+	}
 
-	return r.timestamp, r.id, nil
+	return events, nil
 }
 
 func ReadLine(fd int) (uint8, error) {
@@ -98,6 +118,151 @@ func WriteLine(fd int, v uint8) error {
 	return nil
 }
 
+// ReadLines reads the first n lines of a v1 handle
+func ReadLines(fd, n int) ([]uint8, error) {
+	r := gpiohandle_data{}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), GPIOHANDLE_GET_LINE_VALUES_IOCTL, uintptr(unsafe.Pointer(&r))); errno != 0 {
+		return nil, errno
+	}
+	return r.values[:n], nil
+}
+
+// WriteLines sets the lines of a v1 handle together
+func WriteLines(fd int, v []uint8) error {
+	r := gpiohandle_data{}
+	copy(r.values[:], v)
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), GPIOHANDLE_SET_LINE_VALUES_IOCTL, uintptr(unsafe.Pointer(&r))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// LineConfig is the configuration applied to every line of a v2 line request
+type LineConfig struct {
+	Flags uint64
+	// DebounceUs is the kernel debounce period in microseconds, zero for none
+	DebounceUs uint32
+	// OutputValues holds initial output values, one bit per requested line
+	OutputValues uint64
+}
+
+// raw converts a LineConfig into the kernel structure for numLines lines
+func (lc LineConfig) raw(numLines int) gpio_v2_line_config {
+	r := gpio_v2_line_config{}
+	r.flags = lc.Flags
+
+	// A shift of 64 gives zero, so a full request still gets all bits
+	mask := uint64(1)<<uint(numLines) - 1
+
+	if lc.DebounceUs != 0 {
+		attr := gpio_v2_line_attribute{id: GPIO_V2_LINE_ATTR_ID_DEBOUNCE}
+		attr.setDebounce(lc.DebounceUs)
+		r.attrs[r.num_attrs] = gpio_v2_line_config_attribute{attr: attr, mask: mask}
+		r.num_attrs++
+	}
+
+	if lc.Flags&GPIO_V2_LINE_FLAG_OUTPUT != 0 {
+		r.attrs[r.num_attrs] = gpio_v2_line_config_attribute{
+			attr: gpio_v2_line_attribute{id: GPIO_V2_LINE_ATTR_ID_OUTPUT_VALUES, value: lc.OutputValues},
+			mask: mask,
+		}
+		r.num_attrs++
+	}
+
+	return r
+}
+
+// setDebounce stores the u32 debounce_period_us member of the attribute
+// union, which occupies its first four bytes in native byte order
+func (a *gpio_v2_line_attribute) setDebounce(us uint32) {
+	*(*uint32)(unsafe.Pointer(&a.value)) = us
+}
+
+// GetLineV2 requests lines using the v2 uAPI, returning the line request fd
+func GetLineV2(cfd int, offsets []int, lc LineConfig) (int, error) {
+	if len(offsets) == 0 || len(offsets) > GPIO_V2_LINES_MAX {
+		return -1, fmt.Errorf("Can't request %v lines", len(offsets))
+	}
+
+	r := gpio_v2_line_request{}
+	for i, o := range offsets {
+		r.offsets[i] = uint32(o)
+	}
+	r.num_lines = uint32(len(offsets))
+	r.config = lc.raw(len(offsets))
+	copy(r.consumer[:], ConsumerString)
+
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(cfd), GPIO_V2_GET_LINE_IOCTL, uintptr(unsafe.Pointer(&r))); errno != 0 {
+		return -1, errno
+	}
+
+	return int(r.fd), nil
+}
+
+// SetLineConfigV2 reconfigures the numLines lines of a v2 line request
+// without releasing them
+func SetLineConfigV2(fd, numLines int, lc LineConfig) error {
+	r := lc.raw(numLines)
+
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), GPIO_V2_LINE_SET_CONFIG_IOCTL, uintptr(unsafe.Pointer(&r))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// GetLineValuesV2 reads the lines of a v2 line request selected by mask
+func GetLineValuesV2(fd int, mask uint64) (uint64, error) {
+	r := gpio_v2_line_values{mask: mask}
+
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), GPIO_V2_LINE_GET_VALUES_IOCTL, uintptr(unsafe.Pointer(&r))); errno != 0 {
+		return 0, errno
+	}
+	return r.bits & mask, nil
+}
+
+// SetLineValuesV2 writes the lines of a v2 line request selected by mask
+func SetLineValuesV2(fd int, mask, bits uint64) error {
+	r := gpio_v2_line_values{bits: bits, mask: mask}
+
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), GPIO_V2_LINE_SET_VALUES_IOCTL, uintptr(unsafe.Pointer(&r))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// LineEvent is an edge reported by a line request.  Events read using
+// the v1 uAPI have no sequence numbers or offset.
+type LineEvent struct {
+	Timestamp uint64 // nanoseconds, CLOCK_MONOTONIC for v2 events
+	ID        uint32 // GPIO_V2_LINE_EVENT_RISING_EDGE or GPIO_V2_LINE_EVENT_FALLING_EDGE
+	Offset    uint32
+	Seqno     uint32 // sequence number across all lines in the request
+	LineSeqno uint32 // sequence number for this line
+}
+
+// ReadEventsV2 reads all the queued events from a v2 line request,
+// up to eventBatch of them
+func ReadEventsV2(fd int) ([]LineEvent, error) {
+	evSize := int(unsafe.Sizeof(gpio_v2_line_event{}))
+	buf := make([]byte, evSize*eventBatch)
+
+	n, err := syscall.Read(fd, buf)
+	if err != nil {
+		return nil, err
+	}
+	if n%evSize != 0 {
+		return nil, fmt.Errorf("Incomplete event read %v, expected multiple of %v bytes", n, evSize)
+	}
+
+	events := make([]LineEvent, 0, n/evSize)
+	for i := 0; i < n; i += evSize {
+		r := (*gpio_v2_line_event)(unsafe.Pointer(&buf[i]))
+		events = append(events, LineEvent{r.timestamp_ns, r.id, r.offset, r.seqno, r.line_seqno})
+	}
+
+	return events, nil
+}
+
 // _IOR is a helper function used by gpio.h.go
 func _IOR(typ, nr, size uintptr) uintptr {
 	return uintptr((2 << 30) | (typ << 8) | (nr) | (size << 16))
@@ -0,0 +1,90 @@
+package gpiochip
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const devPattern = "/dev/gpiochip*"
+
+// chipNumbers lists the numbers of the gpio chips present in /dev
+func chipNumbers() ([]int, error) {
+	devs, err := filepath.Glob(devPattern)
+	if err != nil {
+		return nil, err
+	}
+
+	var chips []int
+	for _, dev := range devs {
+		n, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(dev), pinPrefix))
+		if err != nil {
+			continue
+		}
+		chips = append(chips, n)
+	}
+	sort.Ints(chips)
+
+	return chips, nil
+}
+
+// findLine searches the chips for a line called line, considering only
+// chips with a matching label unless label is empty.  The line must be
+// unique amongst the chips searched.
+func findLine(label, line string) (chip, offset int, err error) {
+	if line == "" {
+		return 0, 0, fmt.Errorf("Missing GPIO line name")
+	}
+
+	chips, err := chipNumbers()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var matches []string
+	labelFound := false
+
+	for _, c := range chips {
+		cfd, err := getFdForController(c)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		_, chipLabel, lines, err := GetChipInfo(cfd)
+		if err != nil {
+			return 0, 0, fmt.Errorf("Can't get info for gpiochip%d: %v", c, err)
+		}
+
+		if label != "" && chipLabel != label {
+			continue
+		}
+		labelFound = true
+
+		for o := 0; o < lines; o++ {
+			_, name, _, err := GetLineInfo(cfd, o)
+			if err != nil {
+				return 0, 0, fmt.Errorf("Can't get info for gpiochip%d:%d: %v", c, o, err)
+			}
+
+			if name == line {
+				chip, offset = c, o
+				matches = append(matches, fmt.Sprintf("%v%d:%d", pinPrefix, c, o))
+			}
+		}
+	}
+
+	switch {
+	case label != "" && !labelFound:
+		return 0, 0, fmt.Errorf("No GPIO chip labelled %q", label)
+	case len(matches) == 0 && label != "":
+		return 0, 0, fmt.Errorf("No GPIO line named %q on chip %q", line, label)
+	case len(matches) == 0:
+		return 0, 0, fmt.Errorf("No GPIO line named %q", line)
+	case len(matches) > 1:
+		return 0, 0, fmt.Errorf("GPIO line name %q is ambiguous, found at %v", line, strings.Join(matches, ", "))
+	}
+
+	return chip, offset, nil
+}
@@ -4,29 +4,76 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
+
+	"github.com/mhp/tacoma/driver"
 )
 
 type Pin struct {
-	chip         int
-	offset       int
-	fd           int
-	flags        uint32
-	lastEdgeTime time.Time
-	debounce     time.Duration
+	chip   int
+	offset int
+	fd     int
+	// v1 is set when the kernel lacks the v2 uAPI, in which case
+	// the line must be released and requested again to reconfigure it
+	v1 bool
+	// flags are always GPIO_V2_LINE_FLAG_* values, and are translated
+	// when using the v1 uAPI
+	flags    uint64
+	debounce time.Duration
+	// debounced is set once a debounce period has been asked for
+	debounced bool
+	// softDebounce is set when the controller can't debounce the line,
+	// so that it has to be done in userspace as with the v1 uAPI
+	softDebounce bool
+	// settler debounces edges when the kernel can't
+	settler *driver.Settler
+	// lastSeqno is the sequence number of the last event read, so
+	// that events dropped by the kernel can be counted
+	lastSeqno uint32
 }
 
 func (p *Pin) SetInput() error {
-	return p.twiddleFlags(GPIOHANDLE_REQUEST_INPUT, GPIOHANDLE_REQUEST_OUTPUT)
+	return p.twiddleFlags(GPIO_V2_LINE_FLAG_INPUT, GPIO_V2_LINE_FLAG_OUTPUT)
 }
 
 func (p *Pin) SetOutput() error {
-	return p.twiddleFlags(GPIOHANDLE_REQUEST_OUTPUT, GPIOHANDLE_REQUEST_INPUT)
+	return p.twiddleFlags(GPIO_V2_LINE_FLAG_OUTPUT, GPIO_V2_LINE_FLAG_INPUT)
 }
 
 func (p *Pin) SetActiveLow() error {
-	return p.twiddleFlags(GPIOHANDLE_REQUEST_ACTIVE_LOW, 0)
+	return p.twiddleFlags(GPIO_V2_LINE_FLAG_ACTIVE_LOW, 0)
+}
+
+const biasFlags = GPIO_V2_LINE_FLAG_BIAS_PULL_UP | GPIO_V2_LINE_FLAG_BIAS_PULL_DOWN | GPIO_V2_LINE_FLAG_BIAS_DISABLED
+
+func (p *Pin) SetPullUp() error {
+	return p.twiddleFlags(GPIO_V2_LINE_FLAG_BIAS_PULL_UP, biasFlags)
+}
+
+func (p *Pin) SetPullDown() error {
+	return p.twiddleFlags(GPIO_V2_LINE_FLAG_BIAS_PULL_DOWN, biasFlags)
+}
+
+func (p *Pin) SetBiasDisabled() error {
+	return p.twiddleFlags(GPIO_V2_LINE_FLAG_BIAS_DISABLED, biasFlags)
+}
+
+const edgeFlags = GPIO_V2_LINE_FLAG_EDGE_RISING | GPIO_V2_LINE_FLAG_EDGE_FALLING
+
+const driveFlags = GPIO_V2_LINE_FLAG_OPEN_DRAIN | GPIO_V2_LINE_FLAG_OPEN_SOURCE
+
+func (p *Pin) SetPushPull() error {
+	return p.twiddleFlags(0, driveFlags)
+}
+
+func (p *Pin) SetOpenDrain() error {
+	return p.twiddleFlags(GPIO_V2_LINE_FLAG_OPEN_DRAIN, driveFlags)
+}
+
+func (p *Pin) SetOpenSource() error {
+	return p.twiddleFlags(GPIO_V2_LINE_FLAG_OPEN_SOURCE, driveFlags)
 }
 
 const minDebounceDuration = 20 * time.Millisecond
@@ -37,7 +84,13 @@ func (p *Pin) SetDebounce(d time.Duration) error {
 	}
 
 	p.debounce = d
-	return nil
+	p.debounced = true
+
+	if p.v1 {
+		// The settler picks up the new period next time it's armed
+		return nil
+	}
+	return p.twiddleFlags(0, 0)
 }
 
 func (p *Pin) WriteBool(v bool) error {
@@ -46,11 +99,23 @@ func (p *Pin) WriteBool(v bool) error {
 		value = 1
 	}
 
-	return WriteLine(p.fd, value)
+	if p.v1 {
+		return WriteLine(p.fd, value)
+	}
+	return SetLineValuesV2(p.fd, 1, uint64(value))
 }
 
 func (p *Pin) ReadBool() (bool, error) {
-	v, err := ReadLine(p.fd)
+	var v uint64
+	var err error
+
+	if p.v1 {
+		var v1 uint8
+		v1, err = ReadLine(p.fd)
+		v = uint64(v1)
+	} else {
+		v, err = GetLineValuesV2(p.fd, 1)
+	}
 	if err != nil {
 		return false, err
 	}
@@ -62,67 +127,115 @@ func (p *Pin) ReadBool() (bool, error) {
 }
 
 func (p *Pin) GetEpollEvent(onRising, onFalling bool) (*syscall.EpollEvent, error) {
-	cfd, err := getFdForController(p.chip)
-	if err != nil {
-		return nil, err
-	}
+	if !p.v1 {
+		edges := uint64(0)
+		if onRising {
+			edges |= GPIO_V2_LINE_FLAG_EDGE_RISING
+		}
+		if onFalling {
+			edges |= GPIO_V2_LINE_FLAG_EDGE_FALLING
+		}
 
-	events := uint32(0)
-	if onRising {
-		events |= GPIOEVENT_REQUEST_RISING_EDGE
+		// Whether the controller can debounce is only found out by
+		// asking it to
+		if err := p.twiddleFlags(edges, 0); err != nil {
+			return nil, err
+		}
+		if !p.softDebounce {
+			return &syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(p.fd)}, nil
+		}
 	}
-	if onFalling {
-		events |= GPIOEVENT_REQUEST_FALLING_EDGE
+
+	// Debouncing in userspace needs to see every edge
+	if err := p.twiddleFlags(edgeFlags, 0); err != nil {
+		return nil, err
 	}
 
-	if p.fd >= 0 {
-		syscall.Close(p.fd)
+	ack := func() { ReadEventsV2(p.fd) }
+	if p.v1 {
+		ack = func() { ReadEvents(p.fd) }
 	}
 
-	p.fd, err = GetLineEventFd(cfd, p.offset, p.flags, events)
+	s, err := driver.NewSettler(p.fd, syscall.EPOLLIN, p.ReadBool, ack, onRising, onFalling)
 	if err != nil {
 		return nil, err
 	}
+	p.settler = s
 
-	return &syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(p.fd)}, nil
+	return &syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(s.Fd())}, nil
 }
 
-func (p *Pin) IdentifyEdge(ev *syscall.EpollEvent) (r, f bool) {
-	ts_ns, edge, err := ReadEvent(p.fd)
-	if err != nil {
-		return false, false
+func (p *Pin) IdentifyEdges(ev *syscall.EpollEvent) (edges []driver.Edge, dropped int) {
+	if p.settler != nil {
+		return p.settler.IdentifyEdges(p.debounce), 0
 	}
 
-	ts := time.Unix(0, int64(ts_ns))
-	if ts.Sub(p.lastEdgeTime) < p.debounce {
-		return false, false
+	// The kernel has already debounced the edges
+	events, err := ReadEventsV2(p.fd)
+	if err != nil {
+		return nil, 0
 	}
 
-	p.lastEdgeTime = ts
-
-	if (edge & GPIOEVENT_EVENT_RISING_EDGE) != 0 {
-		return true, false
-	} else if (edge & GPIOEVENT_EVENT_FALLING_EDGE) != 0 {
-		return false, true
+	for _, le := range events {
+		// Sequence numbers start at 1, so a gap means the kernel
+		// overflowed its queue and dropped events
+		dropped += int(le.Seqno - p.lastSeqno - 1)
+		p.lastSeqno = le.Seqno
+
+		switch le.ID {
+		case GPIO_V2_LINE_EVENT_RISING_EDGE:
+			edges = append(edges, driver.Edge{Rising: true, Time: monotonicTime(le.Timestamp)})
+		case GPIO_V2_LINE_EVENT_FALLING_EDGE:
+			edges = append(edges, driver.Edge{Rising: false, Time: monotonicTime(le.Timestamp)})
+		}
 	}
 
-	return false, false
+	return edges, dropped
 }
 
-func (p *Pin) twiddleFlags(set, clear uint32) error {
+func (p *Pin) twiddleFlags(set, clear uint64) error {
+	p.flags = p.flags &^ clear
+	p.flags = p.flags | set
+
+	if !p.v1 {
+		// The v2 uAPI can reconfigure the line while we hold it
+		lc := LineConfig{Flags: p.flags}
+
+		// Not every controller can debounce, so it's only asked for
+		// when it matters, and done in userspace if refused
+		wanted := p.flags&edgeFlags != 0 || p.debounced
+		if p.flags&GPIO_V2_LINE_FLAG_INPUT != 0 && wanted && !p.softDebounce {
+			lc.DebounceUs = uint32(p.debounce / time.Microsecond)
+			if SetLineConfigV2(p.fd, 1, lc) == nil {
+				return nil
+			}
+
+			lc.DebounceUs = 0
+			if err := SetLineConfigV2(p.fd, 1, lc); err != nil {
+				return err
+			}
+			p.softDebounce = true
+			return nil
+		}
+
+		return SetLineConfigV2(p.fd, 1, lc)
+	}
+
 	cfd, err := getFdForController(p.chip)
 	if err != nil {
 		return err
 	}
 
-	p.flags = p.flags &^ clear
-	p.flags = p.flags | set
-
 	if p.fd >= 0 {
 		syscall.Close(p.fd)
 	}
 
-	p.fd, err = GetLineFd(cfd, p.offset, p.flags)
+	handleFlags, eventFlags := v1Flags(p.flags)
+	if eventFlags != 0 {
+		p.fd, err = GetLineEventFd(cfd, p.offset, handleFlags, eventFlags)
+	} else {
+		p.fd, err = GetLineFd(cfd, p.offset, handleFlags)
+	}
 	if err != nil {
 		return err
 	}
@@ -130,9 +243,57 @@ func (p *Pin) twiddleFlags(set, clear uint32) error {
 	return nil
 }
 
+// v1Flags translates v2 line flags into v1 handle and event request flags
+func v1Flags(flags uint64) (handleFlags, eventFlags uint32) {
+	translations := []struct {
+		v2     uint64
+		handle uint32
+		event  uint32
+	}{
+		{GPIO_V2_LINE_FLAG_INPUT, GPIOHANDLE_REQUEST_INPUT, 0},
+		{GPIO_V2_LINE_FLAG_OUTPUT, GPIOHANDLE_REQUEST_OUTPUT, 0},
+		{GPIO_V2_LINE_FLAG_ACTIVE_LOW, GPIOHANDLE_REQUEST_ACTIVE_LOW, 0},
+		{GPIO_V2_LINE_FLAG_OPEN_DRAIN, GPIOHANDLE_REQUEST_OPEN_DRAIN, 0},
+		{GPIO_V2_LINE_FLAG_OPEN_SOURCE, GPIOHANDLE_REQUEST_OPEN_SOURCE, 0},
+		{GPIO_V2_LINE_FLAG_BIAS_PULL_UP, GPIOHANDLE_REQUEST_BIAS_PULL_UP, 0},
+		{GPIO_V2_LINE_FLAG_BIAS_PULL_DOWN, GPIOHANDLE_REQUEST_BIAS_PULL_DOWN, 0},
+		{GPIO_V2_LINE_FLAG_BIAS_DISABLED, GPIOHANDLE_REQUEST_BIAS_DISABLE, 0},
+		{GPIO_V2_LINE_FLAG_EDGE_RISING, 0, GPIOEVENT_REQUEST_RISING_EDGE},
+		{GPIO_V2_LINE_FLAG_EDGE_FALLING, 0, GPIOEVENT_REQUEST_FALLING_EDGE},
+	}
+
+	for _, t := range translations {
+		if flags&t.v2 != 0 {
+			handleFlags |= t.handle
+			eventFlags |= t.event
+		}
+	}
+
+	return handleFlags, eventFlags
+}
+
+// requestLines claims lines without changing their configuration, using
+// the v2 uAPI if the kernel supports it
+func requestLines(cfd int, offsets []int) (fd int, v1 bool, err error) {
+	fd, err = GetLineV2(cfd, offsets, LineConfig{})
+	if err != syscall.EINVAL && err != syscall.ENOTTY {
+		return fd, false, err
+	}
+
+	// Kernels before 5.10 reject the v2 ioctl, so fall back to v1
+	fd, err = GetLinesFd(cfd, offsets, 0)
+	return fd, true, err
+}
+
+// controllerMap caches controller fds, and is also used from http
+// handlers describing the hardware, hence the lock
 var controllerMap = make(map[int]int)
+var controllerLock sync.Mutex
 
 func getFdForController(chip int) (int, error) {
+	controllerLock.Lock()
+	defer controllerLock.Unlock()
+
 	if fd, ok := controllerMap[chip]; ok {
 		return fd, nil
 	}
@@ -150,40 +311,62 @@ func getFdForController(chip int) (int, error) {
 }
 
 const pinPrefix = "gpiochip"
+const namePrefix = "gpio:"
 
-func RecognisePin(name string) bool {
-	return strings.HasPrefix(name, pinPrefix)
-}
-
+// CreatePin accepts pins as gpiochipN:M, by chip number and line offset,
+// or by line name as gpio:<line-name> or gpiochip:<chip-label>:<line-name>
 func CreatePin(name string) (*Pin, error) {
-	if strings.HasPrefix(name, pinPrefix) {
+	var chip, offset int
+	var err error
+
+	switch {
+	case strings.HasPrefix(name, namePrefix):
+		chip, offset, err = findLine("", strings.TrimPrefix(name, namePrefix))
+		if err != nil {
+			return nil, err
+		}
+
+	case strings.HasPrefix(name, pinPrefix+":"):
+		parts := strings.SplitN(strings.TrimPrefix(name, pinPrefix+":"), ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("Can't parse chip label and line name: %v", name)
+		}
+
+		chip, offset, err = findLine(parts[0], parts[1])
+		if err != nil {
+			return nil, err
+		}
+
+	case strings.HasPrefix(name, pinPrefix):
 		parts := strings.Split(strings.TrimPrefix(name, pinPrefix), ":")
 		if len(parts) != 2 {
 			return nil, fmt.Errorf("Can't parse pin number: %v", name)
 		}
 
-		chip, err := strconv.ParseUint(parts[0], 10, 8)
+		c, err := strconv.ParseUint(parts[0], 10, 8)
 		if err != nil {
 			return nil, fmt.Errorf("Can't parse pin chip number: %v", name)
 		}
-		offset, err := strconv.ParseUint(parts[1], 10, 8)
+		o, err := strconv.ParseUint(parts[1], 10, 8)
 		if err != nil {
 			return nil, fmt.Errorf("Can't parse pin offset number: %v", name)
 		}
+		chip, offset = int(c), int(o)
 
-		cfd, err := getFdForController(int(chip))
-		if err != nil {
-			return nil, fmt.Errorf("Can't get fd for pin %v: %v", name, err)
-		}
+	default:
+		return nil, fmt.Errorf("Unrecognised pin name: %v", name)
+	}
 
-		pfd, err := GetLineFd(cfd, int(offset), 0)
-		if err != nil {
-			return nil, fmt.Errorf("Can't get line fd for pin %v: %v", name, err)
-		}
+	cfd, err := getFdForController(chip)
+	if err != nil {
+		return nil, fmt.Errorf("Can't get fd for pin %v: %v", name, err)
+	}
 
-		p := &Pin{chip: int(chip), offset: int(offset), fd: pfd, flags: 0, debounce: minDebounceDuration}
-		return p, nil
+	pfd, v1, err := requestLines(cfd, []int{offset})
+	if err != nil {
+		return nil, fmt.Errorf("Can't get line fd for pin %v: %v", name, err)
 	}
 
-	return nil, fmt.Errorf("Unrecognised pin name: %v", name)
+	p := &Pin{chip: chip, offset: offset, fd: pfd, v1: v1, flags: 0, debounce: minDebounceDuration}
+	return p, nil
 }
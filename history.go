@@ -0,0 +1,318 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// History is kept in rolling files under the history directory, with a
+// directory for each input and within that one for each tier.  Each
+// file covers a fixed span of time, is named after the start of that
+// span, and holds fixed-size records of a timestamp and a value.  Files
+// are removed once they have passed out of their tier's retention.
+//
+// The averaged tiers are built up in memory, so a partial minute or
+// hour is lost if the server stops.
+
+// historyTier describes one level of downsampling
+type historyTier struct {
+	name string
+	// interval is the period averaged over, or zero for raw readings
+	interval time.Duration
+	// span is the time covered by each file
+	span time.Duration
+	// retention is how long readings are kept
+	retention time.Duration
+}
+
+const day = 24 * time.Hour
+
+var historyTiers = []historyTier{
+	{"raw", 0, day, 7 * day},
+	{"1m", time.Minute, 7 * day, 91 * day},
+	{"1h", time.Hour, 91 * day, 2 * 364 * day},
+}
+
+const (
+	// recordSize is the size of a record on disk: milliseconds since
+	// the epoch as an int64, and the value as a float32
+	recordSize = 12
+	// historyFileFormat names files after the start of their span
+	historyFileFormat = "20060102T150405Z.dat"
+
+	minLogPeriod = time.Second
+)
+
+// valuedPin is implemented by inputs which can give their reading as a
+// number, so that it can be logged
+type valuedPin interface {
+	Value() (float64, error)
+}
+
+// historySample is one logged reading, as returned by queries
+type historySample struct {
+	Time  time.Time
+	Value float64
+}
+
+// historyLog records the readings of an input
+type historyLog struct {
+	lock  sync.Mutex
+	tiers []*tierLog
+}
+
+// tierLog records one tier of an input's history
+type tierLog struct {
+	historyTier
+	dir string
+
+	// f is the file being appended to, covering the span from start,
+	// and size is how much of it holds whole records
+	f     *os.File
+	start time.Time
+	size  int64
+
+	// bucket is the start of the interval being averaged
+	bucket time.Time
+	sum    float64
+	count  int
+}
+
+// histories holds the history of each logged input, by endpoint name
+var histories = make(map[string]*historyLog)
+
+// logHistory records the value of p every period under dir
+func logHistory(dir, name string, p valuedPin, period time.Duration) error {
+	if period < minLogPeriod {
+		return fmt.Errorf("Log period too short (%v), minimum %v", period, minLogPeriod)
+	}
+
+	h, err := newHistoryLog(dir, name)
+	if err != nil {
+		return err
+	}
+	histories[name] = h
+
+	go func() {
+		t := time.NewTicker(period)
+		failing := false
+
+		for at := range t.C {
+			v, err := p.Value()
+			if err != nil {
+				// Gaps in the history show the input couldn't be read
+				continue
+			}
+
+			err = h.record(at, v)
+			if err != nil && !failing {
+				fmt.Println("Can't log history for", name, err)
+			}
+			failing = err != nil
+		}
+	}()
+
+	return nil
+}
+
+// newHistoryLog creates the directories for the history of an input
+func newHistoryLog(dir, name string) (*historyLog, error) {
+	if dir == "" {
+		return nil, errors.New("No HistoryDir to log to")
+	}
+
+	h := &historyLog{}
+	for _, tier := range historyTiers {
+		tdir := filepath.Join(dir, url.PathEscape(name), tier.name)
+		if err := os.MkdirAll(tdir, 0755); err != nil {
+			return nil, err
+		}
+		h.tiers = append(h.tiers, &tierLog{historyTier: tier, dir: tdir})
+	}
+
+	return h, nil
+}
+
+// truncate gives the start of the period of length d containing at.
+// Unlike at.Truncate, periods are counted from the Unix epoch, so that
+// files line up with the times they're named after.
+func truncate(at time.Time, d time.Duration) time.Time {
+	ns := at.UnixNano()
+	return time.Unix(0, ns-ns%int64(d))
+}
+
+// record adds a reading to every tier
+func (h *historyLog) record(at time.Time, v float64) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for _, t := range h.tiers {
+		if err := t.record(at, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *tierLog) record(at time.Time, v float64) error {
+	if t.interval == 0 {
+		return t.write(at, v)
+	}
+
+	// Write out the average once a reading arrives for the next interval
+	bucket := truncate(at, t.interval)
+	if t.count > 0 && !bucket.Equal(t.bucket) {
+		if err := t.write(t.bucket, t.sum/float64(t.count)); err != nil {
+			return err
+		}
+		t.sum, t.count = 0, 0
+	}
+
+	t.bucket = bucket
+	t.sum += v
+	t.count++
+	return nil
+}
+
+// write appends a record, moving on to a new file when the span of
+// the current one is over
+func (t *tierLog) write(at time.Time, v float64) error {
+	start := truncate(at, t.span)
+	if t.f == nil || !start.Equal(t.start) {
+		if t.f != nil {
+			t.f.Close()
+			t.f = nil
+		}
+
+		f, err := os.OpenFile(filepath.Join(t.dir, start.UTC().Format(historyFileFormat)),
+			os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return err
+		}
+
+		// Drop any partial record left by a failed write, so that
+		// new records are aligned
+		size := fi.Size()
+		if partial := size % recordSize; partial != 0 {
+			size -= partial
+			if err := f.Truncate(size); err != nil {
+				f.Close()
+				return err
+			}
+		}
+		t.f, t.start, t.size = f, start, size
+
+		t.prune(at)
+	}
+
+	rec := make([]byte, recordSize)
+	binary.LittleEndian.PutUint64(rec, uint64(at.UnixNano()/int64(time.Millisecond)))
+	binary.LittleEndian.PutUint32(rec[8:], math.Float32bits(float32(v)))
+
+	n, err := t.f.Write(rec)
+	if err != nil {
+		// Drop any partial record, so that later ones stay aligned
+		t.f.Truncate(t.size)
+		return err
+	}
+	t.size += int64(n)
+	return nil
+}
+
+// prune removes files which have passed out of retention
+func (t *tierLog) prune(now time.Time) {
+	files, err := ioutil.ReadDir(t.dir)
+	if err != nil {
+		return
+	}
+
+	for _, fi := range files {
+		start, err := time.Parse(historyFileFormat, fi.Name())
+		if err != nil {
+			continue
+		}
+
+		if start.Add(t.span).Before(now.Add(-t.retention)) {
+			os.Remove(filepath.Join(t.dir, fi.Name()))
+		}
+	}
+}
+
+// query gives the readings in a tier from the start time up to, but
+// not including, the end time.  The files are read without holding the
+// lock, so that a long query doesn't hold up logging.
+func (h *historyLog) query(tier string, from, to time.Time) ([]historySample, error) {
+	h.lock.Lock()
+	var t *tierLog
+	for _, tl := range h.tiers {
+		if tl.name == tier {
+			t = tl
+		}
+	}
+	if t == nil {
+		h.lock.Unlock()
+		return nil, fmt.Errorf("Unknown tier %q (expected raw, 1m or 1h)", tier)
+	}
+
+	// Only records already written to the current file are read, in
+	// case more are appended during the query
+	dir, span := t.dir, t.span
+	var current string
+	var currentSize int64
+	if t.f != nil {
+		current, currentSize = t.start.UTC().Format(historyFileFormat), t.size
+	}
+	h.lock.Unlock()
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := []historySample{}
+	for _, fi := range files {
+		start, err := time.Parse(historyFileFormat, fi.Name())
+		if err != nil || !start.Before(to) || !start.Add(span).After(from) {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, fi.Name()))
+		if os.IsNotExist(err) {
+			// Pruned since the directory was read
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if fi.Name() == current && int64(len(data)) > currentSize {
+			data = data[:currentSize]
+		}
+
+		// Any partial record at the end is ignored
+		for ; len(data) >= recordSize; data = data[recordSize:] {
+			ms := int64(binary.LittleEndian.Uint64(data))
+			at := time.Unix(ms/1000, ms%1000*int64(time.Millisecond))
+			if at.Before(from) || !at.Before(to) {
+				continue
+			}
+
+			v := math.Float32frombits(binary.LittleEndian.Uint32(data[8:]))
+			samples = append(samples, historySample{at, float64(v)})
+		}
+	}
+
+	return samples, nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 2026-01-01 is a Thursday, as was the Unix epoch, so it starts a span
+// in every tier
+var historyBase = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newTestHistory(t *testing.T) (*historyLog, string) {
+	dir := t.TempDir()
+	h, err := newHistoryLog(dir, "temp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h, filepath.Join(dir, "temp")
+}
+
+func record(t *testing.T, h *historyLog, at time.Time, v float64) {
+	if err := h.record(at, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func query(t *testing.T, h *historyLog, tier string, from, to time.Time) []historySample {
+	samples, err := h.query(tier, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return samples
+}
+
+func checkSamples(t *testing.T, got []historySample, want ...historySample) {
+	if len(got) != len(want) {
+		t.Fatalf("Got %v samples, expected %v: %v", len(got), len(want), got)
+	}
+	for i := range want {
+		if !got[i].Time.Equal(want[i].Time) || got[i].Value != want[i].Value {
+			t.Errorf("Sample %v is %v, expected %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestHistoryRecordAndQuery(t *testing.T) {
+	h, _ := newTestHistory(t)
+
+	for i, v := range []float64{1.5, 2.5, 3.5} {
+		record(t, h, historyBase.Add(time.Duration(i)*10*time.Second), v)
+	}
+
+	// The end of the range is excluded
+	checkSamples(t, query(t, h, "raw", historyBase, historyBase.Add(20*time.Second)),
+		historySample{historyBase, 1.5},
+		historySample{historyBase.Add(10 * time.Second), 2.5})
+
+	checkSamples(t, query(t, h, "raw", historyBase.Add(5*time.Second), historyBase.Add(time.Minute)),
+		historySample{historyBase.Add(10 * time.Second), 2.5},
+		historySample{historyBase.Add(20 * time.Second), 3.5})
+
+	if _, err := h.query("1d", historyBase, historyBase.Add(time.Minute)); err == nil {
+		t.Error("Expected an error for an unknown tier")
+	}
+}
+
+func TestHistoryAverages(t *testing.T) {
+	h, _ := newTestHistory(t)
+
+	record(t, h, historyBase, 1)
+	record(t, h, historyBase.Add(30*time.Second), 3)
+
+	// The average is only written once the minute is over
+	checkSamples(t, query(t, h, "1m", historyBase, historyBase.Add(time.Hour)))
+
+	record(t, h, historyBase.Add(time.Minute), 10)
+	checkSamples(t, query(t, h, "1m", historyBase, historyBase.Add(time.Hour)),
+		historySample{historyBase, 2})
+}
+
+func TestHistorySpansFromEpoch(t *testing.T) {
+	h, dir := newTestHistory(t)
+
+	// Minutes averaged on Saturday are in the file for the week
+	// starting on Thursday
+	sat := historyBase.Add(2 * day)
+	record(t, h, sat, 1)
+	record(t, h, sat.Add(time.Minute), 1)
+
+	name := historyBase.Format(historyFileFormat)
+	if _, err := os.Stat(filepath.Join(dir, "1m", name)); err != nil {
+		t.Errorf("Expected 1m history in %v: %v", name, err)
+	}
+}
+
+func TestHistoryRotation(t *testing.T) {
+	h, dir := newTestHistory(t)
+
+	record(t, h, historyBase.Add(time.Hour), 1)
+	record(t, h, historyBase.Add(day+time.Hour), 2)
+
+	for _, at := range []time.Time{historyBase, historyBase.Add(day)} {
+		name := at.Format(historyFileFormat)
+		fi, err := os.Stat(filepath.Join(dir, "raw", name))
+		if err != nil {
+			t.Errorf("Expected raw history in %v: %v", name, err)
+		} else if fi.Size() != recordSize {
+			t.Errorf("%v holds %v bytes, expected one record", name, fi.Size())
+		}
+	}
+
+	checkSamples(t, query(t, h, "raw", historyBase, historyBase.Add(2*day)),
+		historySample{historyBase.Add(time.Hour), 1},
+		historySample{historyBase.Add(day + time.Hour), 2})
+}
+
+func TestHistoryPrune(t *testing.T) {
+	h, dir := newTestHistory(t)
+
+	record(t, h, historyBase, 1)
+	record(t, h, historyBase.Add(7*day), 2)
+
+	// The first day is only just out of retention
+	first := filepath.Join(dir, "raw", historyBase.Format(historyFileFormat))
+	if _, err := os.Stat(first); err != nil {
+		t.Errorf("History pruned too early: %v", err)
+	}
+
+	record(t, h, historyBase.Add(9*day), 3)
+	if _, err := os.Stat(first); !os.IsNotExist(err) {
+		t.Errorf("Expected %v to be pruned, got %v", first, err)
+	}
+
+	checkSamples(t, query(t, h, "raw", historyBase, historyBase.Add(10*day)),
+		historySample{historyBase.Add(7 * day), 2},
+		historySample{historyBase.Add(9 * day), 3})
+}
+
+func TestHistoryPartialRecord(t *testing.T) {
+	h, dir := newTestHistory(t)
+
+	// Leave a whole record followed by part of another, as a failed
+	// write would
+	record(t, h, historyBase, 1)
+	tl := h.tiers[0]
+	tl.f.Close()
+	tl.f = nil
+
+	name := filepath.Join(dir, "raw", historyBase.Format(historyFileFormat))
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(make([]byte, recordSize/2))
+	f.Close()
+
+	record(t, h, historyBase.Add(time.Second), 2)
+
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 2*recordSize {
+		t.Errorf("History file holds %v bytes, expected %v", len(data), 2*recordSize)
+	}
+
+	checkSamples(t, query(t, h, "raw", historyBase, historyBase.Add(time.Minute)),
+		historySample{historyBase, 1},
+		historySample{historyBase.Add(time.Second), 2})
+}
+
+func TestHistoryNeedsDir(t *testing.T) {
+	if _, err := newHistoryLog("", "temp"); err == nil {
+		t.Error("Expected an error without a HistoryDir")
+	}
+}
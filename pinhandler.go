@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 )
 
 // PinHandler is the generic interface to a pin, for the purposes
@@ -15,6 +16,8 @@ type PinHandler interface {
 	Exported() bool
 	Direction() string
 	Inverted() bool
+	Fault() string
+	Units() string
 	String() string
 
 	ServeHTTP(http.ResponseWriter, *http.Request)
@@ -26,6 +29,59 @@ type readablePin interface {
 	Read() (string, error)
 }
 
+// queryablePin is implemented by pins offering alternative readings,
+// selected by query parameters on a GET
+type queryablePin interface {
+	ReadQuery(url.Values) (string, error)
+}
+
+// queryListingPin is implemented by queryable pins which list the
+// parameters they recognise, so that others (such as cache-busters)
+// can be ignored
+type queryListingPin interface {
+	Queries() []string
+}
+
+// queryError is returned by ReadQuery when the pin can't answer a
+// query, as opposed to failing to read
+type queryError string
+
+func (e queryError) Error() string {
+	return string(e)
+}
+
+// requestError is returned by Write when the request can't be carried
+// out, as opposed to failing to write, and gives the status to answer
+// with
+type requestError struct {
+	status int
+	msg    string
+}
+
+func (e requestError) Error() string {
+	return e.msg
+}
+
+// isQuery reports whether the request is for one of the pin's queries
+func isQuery(pin readablePin, q url.Values) (queryablePin, bool) {
+	qp, ok := pin.(queryablePin)
+	if !ok {
+		return nil, false
+	}
+
+	lp, ok := pin.(queryListingPin)
+	if !ok {
+		return qp, len(q) > 0
+	}
+
+	for _, key := range lp.Queries() {
+		if _, ok := q[key]; ok {
+			return qp, true
+		}
+	}
+	return nil, false
+}
+
 type pinHandler struct {
 	name     string
 	endpoint string
@@ -78,6 +134,32 @@ func (h pinHandler) Direction() string {
 	return "output"
 }
 
+// Fault describes any fault reported by the pin, or is empty
+func (h pinHandler) Fault() string {
+	fp, ok := h.pin.(FaultReportingPin)
+	if !ok {
+		return ""
+	}
+
+	if err := fp.Fault(); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// unitsPin is implemented by pins whose readings have units
+type unitsPin interface {
+	Units() string
+}
+
+// Units gives the units of the pin's value, or is empty
+func (h pinHandler) Units() string {
+	if up, ok := h.pin.(unitsPin); ok {
+		return up.Units()
+	}
+	return ""
+}
+
 // String lets a PinHandler have the underlying value read whilst
 // evaluating a template for a trigger body
 func (h pinHandler) String() string {
@@ -92,8 +174,18 @@ func (h pinHandler) String() string {
 // GET/PUT requests for the underlying pin
 func (h pinHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "GET" {
-		v, err := h.pin.Read()
-		if err != nil {
+		var v string
+		var err error
+
+		if qp, ok := isQuery(h.pin, r.URL.Query()); ok {
+			v, err = qp.ReadQuery(r.URL.Query())
+		} else {
+			v, err = h.pin.Read()
+		}
+
+		if qe, ok := err.(queryError); ok {
+			http.Error(w, "Query not supported: "+qe.Error(), http.StatusBadRequest)
+		} else if err != nil {
 			http.Error(w, "Unable to read value", http.StatusInternalServerError)
 		} else {
 			fmt.Fprintf(w, "%v", v)
@@ -112,8 +204,12 @@ func (h pinHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
-			if err := op.Write(body); err != nil {
-				http.Error(w, "Unable to write value", http.StatusInternalServerError)
+			err = op.Write(body)
+			if re, ok := err.(requestError); ok {
+				http.Error(w, "Unable to write value: "+re.Error(), re.status)
+				return
+			} else if err != nil {
+				http.Error(w, "Unable to write value: "+err.Error(), http.StatusInternalServerError)
 				return
 			} else {
 				w.WriteHeader(http.StatusOK)
@@ -3,6 +3,8 @@ package main
 import (
 	"syscall"
 	"time"
+
+	"github.com/mhp/tacoma/driver"
 )
 
 // InputPin defines the bare minimum for a pin - it can be configured as an Input
@@ -29,6 +31,35 @@ type DigitalOutputPin interface {
 	WriteBool(bool) error
 }
 
+// BiasedPin is implemented by inputs which can select internal
+// pull-up or pull-down resistors
+type BiasedPin interface {
+	SetPullUp() error
+	SetPullDown() error
+	SetBiasDisabled() error
+}
+
+// DrivenPin is implemented by outputs which can select how the
+// line is driven
+type DrivenPin interface {
+	SetPushPull() error
+	SetOpenDrain() error
+	SetOpenSource() error
+}
+
+// ActiveLowPin is implemented by any pin which can be inverted
+type ActiveLowPin interface {
+	SetActiveLow() error
+}
+
+// BusPin is a group of digital lines read or written together as a
+// number, with the first line as the least significant bit
+type BusPin interface {
+	Width() int
+	ReadBits() (uint64, error)
+	WriteBits(uint64) error
+}
+
 // AnalogueInputPin defines what an analogue pin can do
 type AnalogueInputPin interface {
 	MinValue() int
@@ -36,6 +67,48 @@ type AnalogueInputPin interface {
 	ReadValue() (int, error)
 }
 
+// FullScalePin is implemented by analogue inputs with selectable gain.
+// FullScale gives the voltage of the input range, which a reading of
+// MaxValue+1 would represent.
+type FullScalePin interface {
+	SetFullScale(volts float64) error
+	FullScale() float64
+}
+
+// SampleRatePin is implemented by analogue inputs with a selectable
+// conversion rate, in samples per second
+type SampleRatePin interface {
+	SetSampleRate(sps int) error
+}
+
+// ComparatorPin is implemented by analogue inputs which can compare
+// readings against thresholds in hardware, signalling on a separate
+// alert input.  The pin then reports rising edges when a reading goes
+// above high, and falling edges when one goes below low.
+type ComparatorPin interface {
+	SetComparator(alert interface{}, low, high int) error
+}
+
+// AnalogueOutputPin defines what an analogue output can do.  The
+// units of the value are up to the driver.
+type AnalogueOutputPin interface {
+	MinValue() int
+	MaxValue() int
+	ReadValue() (int, error)
+	WriteValue(int) error
+}
+
+// PeriodicPin is implemented by outputs with a configurable period
+type PeriodicPin interface {
+	SetPeriod(time.Duration) error
+}
+
+// FaultReportingPin is implemented by pins which can detect that the
+// hardware they drive has failed.  Fault returns nil while all is well.
+type FaultReportingPin interface {
+	Fault() error
+}
+
 // GenericInputPin allows a string to be read as its value
 type GenericInputPin interface {
 	Read() (string, error)
@@ -47,7 +120,10 @@ type GenericOutputPin interface {
 	Write(string) error
 }
 
+// TriggeringPin can report edges through epoll.  IdentifyEdges is called
+// when the fd is readable, and returns every edge queued along with a
+// count of any the underlying driver knows it has lost.
 type TriggeringPin interface {
 	GetEpollEvent(onRising, onFalling bool) (*syscall.EpollEvent, error)
-	IdentifyEdge(*syscall.EpollEvent) (rising, falling bool)
+	IdentifyEdges(*syscall.EpollEvent) (edges []driver.Edge, dropped int)
 }
@@ -2,77 +2,319 @@ package main
 
 import (
 	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 )
 
+// PulsingOutput turns a digital output into a monostable.  Writing a
+// true level starts a pulse of the default length, writing a duration
+// starts a pulse of that length, and writing a false level ends any
+// pulse early.
 type PulsingOutput struct {
 	DigitalOutputPin
-	v chan<- bool
+	cfg pulseConfig
+	v   chan<- pulseRequest
+
+	// end is when the current pulse finishes, or zero between pulses
+	end time.Time
+	// fault is set when the output couldn't be switched off, and
+	// cleared once it has been
+	fault error
+	lock  sync.Mutex
 }
 
-// WriteBool is the only overridden method - redirect the
-// writes through the channel to the goroutine to serialise
-// them and condition the pulses appropriately
-func (p *PulsingOutput) WriteBool(v bool) error {
-	p.v <- v
-	return nil
+type pulseConfig struct {
+	def, min, max time.Duration
+	// minOff is the shortest time allowed between pulses
+	minOff time.Duration
+	// retrigger allows a write during a pulse to restart it
+	retrigger bool
+	// active is the level of the output during a pulse
+	active bool
+}
+
+type pulseRequest struct {
+	d      time.Duration // zero to end a pulse
+	result chan<- error
 }
 
 const (
 	minAcceptablePulse = time.Millisecond * 5
 	maxAcceptablePulse = time.Second * 300
+	// switchOffRetry is how often a failed switch-off is retried
+	switchOffRetry = time.Second
 )
 
-func NewPulsingOutput(p DigitalOutputPin, pulse string) (DigitalOutputPin, error) {
-	duration, err := time.ParseDuration(pulse)
+func NewPulsingOutput(p DigitalOutputPin, cfg Output) (GenericOutputPin, error) {
+	duration, err := time.ParseDuration(cfg.Pulse)
 	if err != nil {
 		return nil, err
 	}
 
-	if duration < minAcceptablePulse {
-		return nil, fmt.Errorf("Duration too short (%v), minimum %v", duration, minAcceptablePulse)
+	pc := pulseConfig{
+		def:       duration,
+		min:       minAcceptablePulse,
+		max:       maxAcceptablePulse,
+		retrigger: !cfg.PulseNoRetrigger,
+		active:    !cfg.PulseLow,
 	}
 
-	if duration > maxAcceptablePulse {
-		return nil, fmt.Errorf("Duration too long (%v), maximum %v", duration, maxAcceptablePulse)
+	for _, opt := range []struct {
+		name  string
+		value string
+		d     *time.Duration
+	}{
+		{"PulseMin", cfg.PulseMin, &pc.min},
+		{"PulseMax", cfg.PulseMax, &pc.max},
+		{"PulseMinOff", cfg.PulseMinOff, &pc.minOff},
+	} {
+		if opt.value == "" {
+			continue
+		}
+		if *opt.d, err = time.ParseDuration(opt.value); err != nil {
+			return nil, fmt.Errorf("Can't parse %v: %v", opt.name, err)
+		}
 	}
 
-	vchan := make(chan bool)
-	go pulseControl(p, duration, vchan)
+	if pc.min < minAcceptablePulse {
+		return nil, fmt.Errorf("Minimum duration too short (%v), minimum %v", pc.min, minAcceptablePulse)
+	}
+
+	if pc.max > maxAcceptablePulse {
+		return nil, fmt.Errorf("Maximum duration too long (%v), maximum %v", pc.max, maxAcceptablePulse)
+	}
+
+	if duration < pc.min {
+		return nil, fmt.Errorf("Duration too short (%v), minimum %v", duration, pc.min)
+	}
 
-	return &PulsingOutput{p, vchan}, nil
+	if duration > pc.max {
+		return nil, fmt.Errorf("Duration too long (%v), maximum %v", duration, pc.max)
+	}
+
+	// Start out idle
+	if err := p.WriteBool(!pc.active); err != nil {
+		return nil, err
+	}
+
+	vchan := make(chan pulseRequest)
+	po := &PulsingOutput{DigitalOutputPin: p, cfg: pc, v: vchan}
+	go po.pulseControl(vchan)
+
+	return po, nil
 }
 
-func pulseControl(p DigitalOutputPin, d time.Duration, v <-chan bool) {
+// Write accepts a level, or a duration for a pulse of that length
+func (p *PulsingOutput) Write(value string) error {
+	value = strings.TrimSpace(value)
+
+	d := p.cfg.def
+	if pd, err := time.ParseDuration(value); err == nil {
+		// A zero duration, however it's written, ends the pulse
+		if pd != 0 && (pd < p.cfg.min || pd > p.cfg.max) {
+			return requestError{http.StatusBadRequest,
+				fmt.Sprintf("Pulse duration %v outside %v to %v", pd, p.cfg.min, p.cfg.max)}
+		}
+		d = pd
+	} else if !parseLevel(value) {
+		d = 0
+	}
+
+	return p.request(d)
+}
+
+// WriteBool starts a pulse of the default length, or ends a pulse
+func (p *PulsingOutput) WriteBool(v bool) error {
+	if v {
+		return p.request(p.cfg.def)
+	}
+	return p.request(0)
+}
+
+// request passes a pulse request to the goroutine, waiting for the result
+func (p *PulsingOutput) request(d time.Duration) error {
+	result := make(chan error)
+	p.v <- pulseRequest{d, result}
+	return <-result
+}
+
+// Read gives 1 during a pulse and 0 otherwise, whichever level the
+// output is driven to for a pulse
+func (p *PulsingOutput) Read() (string, error) {
+	v, err := p.ReadBool()
+	if err != nil {
+		return "n/a", nil
+	}
+
+	if v == p.cfg.active {
+		return "1", nil
+	}
+	return "0", nil
+}
+
+func (p *PulsingOutput) Queries() []string {
+	return []string{"remaining", "fault"}
+}
+
+// ReadQuery supports ?remaining, giving the time left in the current
+// pulse, and ?fault, giving any switch-off fault
+func (p *PulsingOutput) ReadQuery(q url.Values) (string, error) {
+	if _, ok := q["remaining"]; ok {
+		return p.remaining().String(), nil
+	}
+
+	if _, ok := q["fault"]; ok {
+		if err := p.Fault(); err != nil {
+			return err.Error(), nil
+		}
+		return "", nil
+	}
+
+	return "", queryError("Unsupported query " + q.Encode())
+}
+
+// Fault reports a failure to switch the output off at the end of a pulse
+func (p *PulsingOutput) Fault() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.fault
+}
+
+func (p *PulsingOutput) setFault(err error) {
+	p.lock.Lock()
+	p.fault = err
+	p.lock.Unlock()
+}
+
+func (p *PulsingOutput) remaining() time.Duration {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.end.IsZero() {
+		return 0
+	}
+
+	if r := time.Until(p.end); r > 0 {
+		return r
+	}
+	return 0
+}
+
+func (p *PulsingOutput) setEnd(end time.Time) {
+	p.lock.Lock()
+	p.end = end
+	p.lock.Unlock()
+}
+
+// switchOff returns the output to idle, recording a fault if that fails
+// since leaving the output active may be unsafe.  It returns whether the
+// output is now idle.
+func (p *PulsingOutput) switchOff() bool {
+	if err := p.DigitalOutputPin.WriteBool(!p.cfg.active); err != nil {
+		if p.Fault() == nil {
+			fmt.Println("Pulse switch-off failed, output may still be active:", err)
+		}
+		p.setFault(fmt.Errorf("Switch-off failed at %v: %v", time.Now().Format(time.RFC3339), err))
+		return false
+	}
+
+	if p.Fault() != nil {
+		fmt.Println("Pulse switch-off succeeded, fault cleared")
+		p.setFault(nil)
+	}
+	return true
+}
+
+func (p *PulsingOutput) pulseControl(v <-chan pulseRequest) {
 	// Create a stopped timer, ready to use when a pulse starts
-	t := time.NewTimer(d)
+	t := time.NewTimer(p.cfg.def)
 	if !t.Stop() {
 		<-t.C
 	}
 	// running allows us to determine whether the timer
 	// should be stopped before resetting, to prevent a race
 	running := false
+	// lastEnd is when the last pulse finished, for enforcing minOff
+	var lastEnd time.Time
+	// retry fires while a failed switch-off is being retried
+	var retry <-chan time.Time
+
+	// end finishes a pulse, retrying the switch-off until it works
+	end := func() error {
+		if running {
+			lastEnd = time.Now()
+		}
+		running = false
+		p.setEnd(time.Time{})
+
+		if p.switchOff() {
+			retry = nil
+			return nil
+		}
+
+		retry = time.After(switchOffRetry)
+		return p.Fault()
+	}
 
 	for {
 		select {
-		case value := <-v: // New output value to set
-			// Discard error :-(
-			p.WriteBool(value)
+		case req := <-v: // New pulse to start, or end of pulse
+			now := time.Now()
+
+			if req.d == 0 {
+				if running && !t.Stop() {
+					<-t.C
+				}
+
+				req.result <- end()
+				continue
+			}
+
+			if err := p.Fault(); err != nil {
+				req.result <- fmt.Errorf("Output faulty, not pulsing: %v", err)
+				continue
+			}
+
+			if running && !p.cfg.retrigger {
+				// Like a monostable, don't retrigger during a pulse,
+				// but tell the caller the write had no effect
+				req.result <- requestError{http.StatusConflict, "Pulse already running"}
+				continue
+			}
+
+			if !running && now.Sub(lastEnd) < p.cfg.minOff {
+				req.result <- requestError{http.StatusConflict,
+					fmt.Sprintf("Too soon after last pulse, wait %v", lastEnd.Add(p.cfg.minOff).Sub(now))}
+				continue
+			}
 
 			if running && !t.Stop() {
 				<-t.C
 			}
 
-			if value {
-				t.Reset(d)
-				running = true
-			} else {
-				running = false
+			if err := p.DigitalOutputPin.WriteBool(p.cfg.active); err != nil {
+				// The output may or may not have changed, so make sure
+				// it ends up idle
+				end()
+				req.result <- err
+				continue
 			}
 
+			t.Reset(req.d)
+			running = true
+			p.setEnd(now.Add(req.d))
+
+			req.result <- nil
+
 		case <-t.C: // Pulse time has expired
-			p.WriteBool(false)
-			running = false
+			end()
+
+		case <-retry: // Previous switch-off failed
+			end()
 		}
 	}
 }
@@ -0,0 +1,33 @@
+package pwm
+
+import (
+	"encoding/json"
+
+	"github.com/mhp/tacoma/driver"
+)
+
+type config struct {
+	// Root is the directory holding the pwm class, normally /sys/class/pwm
+	Root string
+}
+
+func init() {
+	driver.Register(driver.Driver{
+		Name:         "pwm",
+		Prefix:       pinPrefix,
+		Syntax:       "pwmchipN:M (channel M of /sys/class/pwm/pwmchipN)",
+		Capabilities: []string{"analogue output"},
+		Create: func(name string) (interface{}, error) {
+			return CreatePin(name)
+		},
+		Configure: func(raw json.RawMessage) error {
+			cfg := config{Root: Root}
+			if err := json.Unmarshal(raw, &cfg); err != nil {
+				return err
+			}
+
+			Root = cfg.Root
+			return nil
+		},
+	})
+}
@@ -0,0 +1,131 @@
+package pwm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mhp/tacoma/driver"
+)
+
+// Root is where the pwm class lives
+var Root = "/sys/class/pwm"
+
+// defaultPeriod is used if the channel has no period when enabled
+const defaultPeriod = time.Millisecond
+
+// Pin is a pwm channel.  Its value is the duty cycle in nanoseconds.
+type Pin struct {
+	dir    string
+	period int
+}
+
+func (p *Pin) SetOutput() error {
+	if p.period == 0 {
+		if err := p.SetPeriod(defaultPeriod); err != nil {
+			return err
+		}
+	}
+
+	return p.writeAttr("enable", 1)
+}
+
+// SetPeriod changes the period, clamping the duty cycle if necessary
+// since the kernel won't accept a period shorter than the duty cycle
+func (p *Pin) SetPeriod(d time.Duration) error {
+	period := int(d.Nanoseconds())
+	if period <= 0 {
+		return fmt.Errorf("Period must be positive (%v)", d)
+	}
+
+	duty, err := p.ReadValue()
+	if err != nil {
+		return err
+	}
+
+	if duty > period {
+		if err := p.writeAttr("duty_cycle", period); err != nil {
+			return err
+		}
+	}
+
+	if err := p.writeAttr("period", period); err != nil {
+		return err
+	}
+
+	p.period = period
+	return nil
+}
+
+func (p *Pin) MinValue() int {
+	return 0
+}
+
+func (p *Pin) MaxValue() int {
+	return p.period
+}
+
+func (p *Pin) ReadValue() (int, error) {
+	return p.readAttr("duty_cycle")
+}
+
+func (p *Pin) WriteValue(v int) error {
+	if v < 0 || v > p.period {
+		return fmt.Errorf("Duty cycle %vns outside period %vns", v, p.period)
+	}
+
+	return p.writeAttr("duty_cycle", v)
+}
+
+func (p *Pin) readAttr(attr string) (int, error) {
+	data, err := ioutil.ReadFile(filepath.Join(p.dir, attr))
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+func (p *Pin) writeAttr(attr string, v int) error {
+	return ioutil.WriteFile(filepath.Join(p.dir, attr), []byte(strconv.Itoa(v)), 0644)
+}
+
+const pinPrefix = "pwmchip"
+
+// CreatePin accepts pwmchipN:M, for channel M of pwm chip N,
+// exporting the channel if it isn't already
+func CreatePin(name string) (*Pin, error) {
+	parts := strings.Split(strings.TrimPrefix(name, pinPrefix), ":")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("Can't parse pwm channel: %v", name)
+	}
+
+	chip, err := strconv.ParseUint(parts[0], 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("Can't parse pwm chip number: %v", name)
+	}
+	channel, err := strconv.ParseUint(parts[1], 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("Can't parse pwm channel number: %v", name)
+	}
+
+	chipDir := filepath.Join(Root, fmt.Sprintf("%v%d", pinPrefix, chip))
+	dir := filepath.Join(chipDir, fmt.Sprintf("pwm%d", channel))
+
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := driver.Export(chipDir, int(channel), filepath.Join(dir, "duty_cycle")); err != nil {
+			return nil, fmt.Errorf("Can't export %v: %v", name, err)
+		}
+	}
+
+	p := &Pin{dir: dir}
+	if p.period, err = p.readAttr("period"); err != nil {
+		return nil, fmt.Errorf("Can't read period of %v: %v", name, err)
+	}
+
+	return p, nil
+}
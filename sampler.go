@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSamplePeriod = time.Second
+	minSamplePeriod     = 10 * time.Millisecond
+)
+
+// Sampler reads an analogue input in the background on a fixed period,
+// so that readings can be watched, filtered and fetched without each
+// user polling the hardware itself.
+type Sampler struct {
+	AnalogueInputPin
+	period time.Duration
+	// filter smooths the readings, or is nil to leave them be
+	filter filter
+
+	lock     sync.Mutex
+	watchers []func(v int, at time.Time)
+	// latest is the most recent filtered reading, valid once a reading
+	// has been taken
+	latest int
+	valid  bool
+	// err is set while the input can't be read
+	err error
+}
+
+// NewSampler starts sampling p every period, passing readings through
+// f if it isn't nil
+func NewSampler(p AnalogueInputPin, period time.Duration, f filter) (*Sampler, error) {
+	if period < minSamplePeriod {
+		return nil, fmt.Errorf("Sample period too short (%v), minimum %v", period, minSamplePeriod)
+	}
+
+	s := &Sampler{AnalogueInputPin: p, period: period, filter: f}
+	go s.run()
+
+	return s, nil
+}
+
+// Watch arranges for f to be called with every successful reading.  f
+// is called from the sampling goroutine, so mustn't block.
+func (s *Sampler) Watch(f func(v int, at time.Time)) {
+	s.lock.Lock()
+	s.watchers = append(s.watchers, f)
+	s.lock.Unlock()
+}
+
+// Latest gives the most recent reading without waiting for the hardware
+func (s *Sampler) Latest() (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.err != nil {
+		return 0, s.err
+	} else if !s.valid {
+		return 0, errors.New("No reading yet")
+	}
+	return s.latest, nil
+}
+
+func (s *Sampler) run() {
+	t := time.NewTicker(s.period)
+
+	s.sample(time.Now())
+	for at := range t.C {
+		s.sample(at)
+	}
+}
+
+func (s *Sampler) sample(at time.Time) {
+	v, err := s.ReadValue()
+
+	s.lock.Lock()
+	if (err == nil) != (s.err == nil) {
+		if err != nil {
+			fmt.Println("Sampling failed:", err)
+		} else {
+			fmt.Println("Sampling recovered")
+		}
+	}
+	s.err = err
+	if err == nil {
+		if s.filter != nil {
+			v = s.filter.add(v)
+		}
+		s.latest, s.valid = v, true
+	}
+	watchers := s.watchers
+	s.lock.Unlock()
+
+	if err != nil {
+		return
+	}
+
+	for _, f := range watchers {
+		f(v, at)
+	}
+}
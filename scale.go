@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Scaling converts raw analogue readings into engineering units.  Only
+// one of the methods may be given.
+type Scaling struct {
+	// Gain and Offset give a linear scale, raw*Gain + Offset, with
+	// Gain being 1 if only Offset is given
+	Gain   *float64
+	Offset float64
+	// Table lists [raw, value] points in increasing order of raw
+	// reading.  Readings in between are interpolated, and readings
+	// beyond either end are clamped to it.
+	Table [][2]float64
+	// NTC converts a thermistor's reading to °C
+	NTC *NTC
+}
+
+// NTC describes a thermistor in a voltage divider with a fixed resistor,
+// following the Beta equation.
+type NTC struct {
+	// Beta is the B constant of the thermistor, in kelvin
+	Beta float64
+	// R0 is the resistance of the thermistor in ohms at T0, in °C
+	// (default 25°C)
+	R0 float64
+	T0 float64
+	// Series is the resistance of the fixed resistor in ohms
+	Series float64
+	// Supply is the voltage across the divider.  If it's zero, readings
+	// are taken to be ratiometric, with full-scale at the supply.
+	Supply float64
+	// HighSide is set when the thermistor is between the supply and
+	// the input, rather than between the input and ground
+	HighSide bool
+}
+
+const (
+	defaultNTCT0 = 25
+	zeroCelsius  = 273.15
+)
+
+// scaleFunc converts a raw reading into engineering units
+type scaleFunc func(raw int) (float64, error)
+
+// newScaleFunc checks s and gives the conversion for readings from p
+func newScaleFunc(p AnalogueInputPin, s Scaling) (scaleFunc, error) {
+	methods := 0
+	if s.Gain != nil || s.Offset != 0 {
+		methods++
+	}
+	if s.Table != nil {
+		methods++
+	}
+	if s.NTC != nil {
+		methods++
+	}
+	if methods != 1 {
+		return nil, errors.New("Scaling needs exactly one of Gain/Offset, Table or NTC")
+	}
+
+	switch {
+	case s.Table != nil:
+		return tableScale(s.Table)
+	case s.NTC != nil:
+		return ntcScale(p, *s.NTC)
+	}
+
+	gain, offset := 1.0, s.Offset
+	if s.Gain != nil {
+		if *s.Gain == 0 {
+			return nil, errors.New("Scaling Gain can't be zero")
+		}
+		gain = *s.Gain
+	}
+	return func(raw int) (float64, error) {
+		return float64(raw)*gain + offset, nil
+	}, nil
+}
+
+func tableScale(table [][2]float64) (scaleFunc, error) {
+	if len(table) < 2 {
+		return nil, errors.New("Scaling table needs at least two points")
+	}
+	for i := 1; i < len(table); i++ {
+		if table[i][0] <= table[i-1][0] {
+			return nil, fmt.Errorf("Scaling table isn't in increasing order at %v", table[i][0])
+		}
+	}
+
+	return func(raw int) (float64, error) {
+		r := float64(raw)
+		if r <= table[0][0] {
+			return table[0][1], nil
+		}
+
+		for i := 1; i < len(table); i++ {
+			if r <= table[i][0] {
+				lo, hi := table[i-1], table[i]
+				return lo[1] + (r-lo[0])*(hi[1]-lo[1])/(hi[0]-lo[0]), nil
+			}
+		}
+
+		return table[len(table)-1][1], nil
+	}, nil
+}
+
+func ntcScale(p AnalogueInputPin, ntc NTC) (scaleFunc, error) {
+	if ntc.Beta <= 0 || ntc.R0 <= 0 || ntc.Series <= 0 {
+		return nil, errors.New("NTC needs Beta, R0 and Series")
+	}
+	if ntc.T0 == 0 {
+		ntc.T0 = defaultNTCT0
+	}
+
+	// ratio gives the reading as a fraction of the supply
+	ratio := func(raw int) float64 {
+		return float64(raw) / float64(p.MaxValue()+1)
+	}
+	if ntc.Supply != 0 {
+		fp, ok := p.(FullScalePin)
+		if !ok {
+			return nil, errors.New("NTC Supply needs a pin with a full-scale range")
+		}
+		ratio = func(raw int) float64 {
+			return float64(raw) * fp.FullScale() / float64(p.MaxValue()+1) / ntc.Supply
+		}
+	}
+
+	return func(raw int) (float64, error) {
+		r := ratio(raw)
+		if r <= 0 || r >= 1 {
+			return 0, fmt.Errorf("Thermistor reading %v out of range", raw)
+		}
+
+		rt := ntc.Series * r / (1 - r)
+		if ntc.HighSide {
+			rt = ntc.Series * (1 - r) / r
+		}
+
+		kelvin := 1 / (1/(ntc.T0+zeroCelsius) + math.Log(rt/ntc.R0)/ntc.Beta)
+		return kelvin - zeroCelsius, nil
+	}, nil
+}
@@ -0,0 +1,33 @@
+package sysfs
+
+import (
+	"encoding/json"
+
+	"github.com/mhp/tacoma/driver"
+)
+
+type config struct {
+	// Root is the directory holding the gpio class, normally /sys/class/gpio
+	Root string
+}
+
+func init() {
+	driver.Register(driver.Driver{
+		Name:         "sysfs",
+		Prefix:       pinPrefix,
+		Syntax:       "sysfs:N (legacy /sys/class/gpio number N)",
+		Capabilities: []string{"digital input", "digital output", "edge triggers"},
+		Create: func(name string) (interface{}, error) {
+			return CreatePin(name)
+		},
+		Configure: func(raw json.RawMessage) error {
+			cfg := config{Root: Root}
+			if err := json.Unmarshal(raw, &cfg); err != nil {
+				return err
+			}
+
+			Root = cfg.Root
+			return nil
+		},
+	})
+}
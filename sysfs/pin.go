@@ -0,0 +1,144 @@
+package sysfs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mhp/tacoma/driver"
+)
+
+// Root is where the gpio class lives.  It can be pointed at a
+// directory tree standing in for sysfs when there's no hardware.
+var Root = "/sys/class/gpio"
+
+type Pin struct {
+	number  int
+	dir     string
+	valueFd int
+	// notifyFd is polled for notifyEvents, which are a change in
+	// value on the value file, or readability of a pipe when testing
+	notifyFd     int
+	notifyEvents uint32
+	debounce     time.Duration
+	// settler works out edges, since sysfs only tells us that the
+	// value has changed
+	settler *driver.Settler
+}
+
+func (p *Pin) SetInput() error {
+	return p.writeAttr("direction", "in")
+}
+
+func (p *Pin) SetOutput() error {
+	return p.writeAttr("direction", "out")
+}
+
+func (p *Pin) SetActiveLow() error {
+	return p.writeAttr("active_low", "1")
+}
+
+const minDebounceDuration = 20 * time.Millisecond
+
+func (p *Pin) SetDebounce(d time.Duration) error {
+	if d < minDebounceDuration {
+		return fmt.Errorf("Debounce duration too short (%v<%v)", d, minDebounceDuration)
+	}
+
+	p.debounce = d
+	return nil
+}
+
+func (p *Pin) WriteBool(v bool) error {
+	value := []byte("0")
+	if v {
+		value = []byte("1")
+	}
+
+	_, err := syscall.Pwrite(p.valueFd, value, 0)
+	return err
+}
+
+func (p *Pin) ReadBool() (bool, error) {
+	buf := make([]byte, 2)
+
+	n, err := syscall.Pread(p.valueFd, buf, 0)
+	if err != nil {
+		return false, err
+	}
+	if n == 0 {
+		return false, fmt.Errorf("Empty value read from gpio%d", p.number)
+	}
+
+	return buf[0] != '0', nil
+}
+
+func (p *Pin) GetEpollEvent(onRising, onFalling bool) (*syscall.EpollEvent, error) {
+	// Debouncing needs to see every change, so ask for both edges and
+	// let the settler pick out the ones wanted
+	edge := "none"
+	if onRising || onFalling {
+		edge = "both"
+	}
+
+	if err := p.writeAttr("edge", edge); err != nil {
+		return nil, err
+	}
+
+	s, err := driver.NewSettler(p.notifyFd, p.notifyEvents, p.ReadBool, p.acknowledge, onRising, onFalling)
+	if err != nil {
+		return nil, err
+	}
+	p.settler = s
+
+	return &syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(s.Fd())}, nil
+}
+
+// acknowledge clears a change notification, which sysfs requires to
+// be done by seeking back to the start and reading
+func (p *Pin) acknowledge() {
+	buf := make([]byte, 2)
+	syscall.Seek(p.notifyFd, 0, 0)
+	syscall.Read(p.notifyFd, buf)
+}
+
+func (p *Pin) IdentifyEdges(ev *syscall.EpollEvent) ([]driver.Edge, int) {
+	return p.settler.IdentifyEdges(p.debounce), 0
+}
+
+func (p *Pin) writeAttr(attr, value string) error {
+	return ioutil.WriteFile(filepath.Join(p.dir, attr), []byte(value), 0644)
+}
+
+const pinPrefix = "sysfs:"
+
+// CreatePin accepts sysfs:N, where N is the global gpio number,
+// exporting the line if it isn't already
+func CreatePin(name string) (*Pin, error) {
+	n, err := strconv.ParseUint(strings.TrimPrefix(name, pinPrefix), 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("Can't parse gpio number: %v", name)
+	}
+
+	dir := filepath.Join(Root, fmt.Sprintf("gpio%d", n))
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := driver.Export(Root, int(n), filepath.Join(dir, "value")); err != nil {
+			return nil, fmt.Errorf("Can't export %v: %v", name, err)
+		}
+	}
+
+	fd, err := syscall.Open(filepath.Join(dir, "value"), syscall.O_RDWR|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("Can't open value for %v: %v", name, err)
+	}
+
+	// sysfs signals a change in value as an exceptional condition
+	return &Pin{number: int(n), dir: dir, valueFd: fd,
+		notifyFd: fd, notifyEvents: syscall.EPOLLPRI | syscall.EPOLLERR,
+		debounce: minDebounceDuration}, nil
+}
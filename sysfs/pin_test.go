@@ -0,0 +1,212 @@
+package sysfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/mhp/tacoma/driver"
+)
+
+// makeLine creates the directory the kernel would make for an exported
+// line, with its value set to value
+func makeLine(n string, value string) (string, error) {
+	dir := filepath.Join(Root, "gpio"+n)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return dir, ioutil.WriteFile(filepath.Join(dir, "value"), []byte(value), 0644)
+}
+
+func fakeLine(t *testing.T, n string, value string) string {
+	dir, err := makeLine(n, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func readAttr(t *testing.T, dir, attr string) string {
+	b, err := ioutil.ReadFile(filepath.Join(dir, attr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestCreatePinExports(t *testing.T) {
+	Root = t.TempDir()
+
+	// Stand in for the kernel, creating the line once it's exported
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			if b, err := ioutil.ReadFile(filepath.Join(Root, "export")); err == nil && string(b) == "17" {
+				if _, err := makeLine("17", "0\n"); err != nil {
+					t.Error(err)
+				}
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	p, err := CreatePin("sysfs:17")
+	<-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.number != 17 || p.dir != filepath.Join(Root, "gpio17") {
+		t.Errorf("Got gpio%d in %v", p.number, p.dir)
+	}
+}
+
+func TestCreatePinAlreadyExported(t *testing.T) {
+	Root = t.TempDir()
+	fakeLine(t, "4", "0\n")
+
+	if _, err := CreatePin("sysfs:4"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(Root, "export")); !os.IsNotExist(err) {
+		t.Error("Exported a line which was already exported")
+	}
+}
+
+func TestCreatePinBadName(t *testing.T) {
+	Root = t.TempDir()
+
+	if _, err := CreatePin("sysfs:x"); err == nil {
+		t.Error("Accepted a bad gpio number")
+	}
+}
+
+func TestDirectionAndActiveLow(t *testing.T) {
+	Root = t.TempDir()
+	dir := fakeLine(t, "5", "0\n")
+
+	p, err := CreatePin("sysfs:5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		set   func() error
+		attr  string
+		value string
+	}{
+		{p.SetInput, "direction", "in"},
+		{p.SetOutput, "direction", "out"},
+		{p.SetActiveLow, "active_low", "1"},
+	} {
+		if err := tc.set(); err != nil {
+			t.Fatal(err)
+		}
+		if got := readAttr(t, dir, tc.attr); got != tc.value {
+			t.Errorf("%v is %q, expected %q", tc.attr, got, tc.value)
+		}
+	}
+}
+
+func TestReadWriteBool(t *testing.T) {
+	Root = t.TempDir()
+	dir := fakeLine(t, "6", "1\n")
+
+	p, err := CreatePin("sysfs:6")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := p.ReadBool(); err != nil || !v {
+		t.Errorf("ReadBool gave %v, %v, expected true", v, err)
+	}
+
+	for _, v := range []bool{false, true, false} {
+		if err := p.WriteBool(v); err != nil {
+			t.Fatal(err)
+		}
+
+		if got, err := p.ReadBool(); err != nil || got != v {
+			t.Errorf("ReadBool gave %v, %v after writing %v", got, err, v)
+		}
+
+		expected := "0"
+		if v {
+			expected = "1"
+		}
+		if got := readAttr(t, dir, "value"); got[:1] != expected {
+			t.Errorf("value is %q after writing %v", got, v)
+		}
+	}
+}
+
+// TestEdgesSettle bounces the value file, standing in for the kernel's
+// notifications with a pipe, and checks only the settled level is
+// reported
+func TestEdgesSettle(t *testing.T) {
+	Root = t.TempDir()
+	dir := fakeLine(t, "7", "0\n")
+
+	p, err := CreatePin("sysfs:7")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pipes := make([]int, 2)
+	if err := syscall.Pipe2(pipes, syscall.O_CLOEXEC|syscall.O_NONBLOCK); err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(pipes[0])
+	defer syscall.Close(pipes[1])
+	p.notifyFd, p.notifyEvents = pipes[0], syscall.EPOLLIN
+
+	ev, err := p.GetEpollEvent(true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readAttr(t, dir, "edge"); got != "both" {
+		t.Errorf("edge is %q, expected both", got)
+	}
+
+	// change sets the value and notifies, as the kernel would
+	change := func(value string) []driver.Edge {
+		if err := ioutil.WriteFile(filepath.Join(dir, "value"), []byte(value), 0644); err != nil {
+			t.Fatal(err)
+		}
+		syscall.Write(pipes[1], []byte{0})
+
+		edges, _ := p.IdentifyEdges(ev)
+		return edges
+	}
+
+	// settle waits for the debounce period, then collects any edge
+	settle := func() []driver.Edge {
+		time.Sleep(2 * p.debounce)
+		edges, _ := p.IdentifyEdges(ev)
+		return edges
+	}
+
+	// A bounce which ends up back where it started is no edge at all
+	for _, v := range []string{"1\n", "0\n", "1\n", "0\n"} {
+		if edges := change(v); len(edges) != 0 {
+			t.Errorf("Edge reported while bouncing: %v", edges)
+		}
+	}
+	if edges := settle(); len(edges) != 0 {
+		t.Errorf("Edge reported for a bounce back to low: %v", edges)
+	}
+
+	// A bounce which settles high is a single rising edge
+	for _, v := range []string{"1\n", "0\n", "1\n"} {
+		if edges := change(v); len(edges) != 0 {
+			t.Errorf("Edge reported while bouncing: %v", edges)
+		}
+	}
+	if edges := settle(); len(edges) != 1 || !edges[0].Rising {
+		t.Errorf("Got %v once settled, expected one rising edge", edges)
+	}
+}
@@ -6,28 +6,60 @@ import (
 	"os"
 	"time"
 
-	"github.com/mhp/tacoma/ads1015"
-	"github.com/mhp/tacoma/fakeio"
-	"github.com/mhp/tacoma/gpiochip"
+	"github.com/mhp/tacoma/driver"
+
+	// Pin drivers register themselves when imported
+	_ "github.com/mhp/tacoma/ads1015"
+	_ "github.com/mhp/tacoma/fakeio"
+	_ "github.com/mhp/tacoma/gpiochip"
+	_ "github.com/mhp/tacoma/pwm"
+	_ "github.com/mhp/tacoma/sysfs"
 )
 
+const defaultConfigFile = "config.json"
+
 func main() {
-	if len(os.Args) > 2 {
-		fmt.Println("Usage:", os.Args[0], "[config.json]")
+	args := os.Args[1:]
+	if len(args) > 0 {
+		// A config file may share its name with a command, so only
+		// take the argument as a command if there's no such file
+		if cmd, ok := commands[args[0]]; ok && !fileExists(args[0]) {
+			cmd.run(args[1:])
+			return
+		}
+	}
+
+	if len(args) > 1 {
+		usage()
 		os.Exit(1)
 	}
 
-	cfgFile := "config.json"
-	if len(os.Args) == 2 {
-		cfgFile = os.Args[1]
+	cfgFile := defaultConfigFile
+	if len(args) == 1 {
+		cfgFile = args[0]
 	}
 
+	serve(cfgFile)
+}
+
+func fileExists(name string) bool {
+	fi, err := os.Stat(name)
+	return err == nil && !fi.IsDir()
+}
+
+// serve runs the http server for the pins described by cfgFile
+func serve(cfgFile string) {
 	cfg, err := loadConfig(cfgFile)
 	if err != nil {
 		fmt.Println("Error reading config:", err)
 		os.Exit(1)
 	}
 
+	if err := driver.Configure(cfg.Drivers); err != nil {
+		fmt.Println("Error configuring drivers:", err)
+		os.Exit(1)
+	}
+
 	myHandlers := Handlers{cfg.ServerConfig, nil}
 	myTriggers, err := NewTriggers()
 	if err != nil {
@@ -53,8 +85,18 @@ func main() {
 			os.Exit(1)
 		}
 
+		if cfg.Drive != "" {
+			if dp, ok := p.(DrivenPin); !ok {
+				fmt.Println("Pin doesn't support drive configuration", name)
+				os.Exit(1)
+			} else if err = setDrive(dp, cfg.Drive); err != nil {
+				fmt.Println("Bad output (can't set drive)", name, err)
+				os.Exit(1)
+			}
+		}
+
 		if cfg.Invert {
-			if dp, ok := p.(DigitalOutputPin); !ok {
+			if dp, ok := p.(ActiveLowPin); !ok {
 				fmt.Println("Pin doesn't support inverted operation", name)
 				os.Exit(1)
 			} else if err = dp.SetActiveLow(); err != nil {
@@ -63,12 +105,42 @@ func main() {
 			}
 		}
 
+		if cfg.Period != "" {
+			period, err := time.ParseDuration(cfg.Period)
+			if err != nil {
+				fmt.Println("Can't parse period for", name)
+				os.Exit(1)
+			}
+
+			if pp, ok := p.(PeriodicPin); !ok {
+				fmt.Println("Pin doesn't support setting a period", name)
+				os.Exit(1)
+			} else if err = pp.SetPeriod(period); err != nil {
+				fmt.Println("Bad output (can't set period)", name, err)
+				os.Exit(1)
+			}
+		}
+
+		if cfg.Patterns && cfg.Pulse != "" {
+			fmt.Println("Output can't have both patterns and pulses", name)
+			os.Exit(1)
+		}
+
+		if cfg.Patterns {
+			if dp, ok := p.(DigitalOutputPin); !ok {
+				fmt.Println("Pin cannot be used for patterns", name)
+				os.Exit(1)
+			} else {
+				p = NewPatternedOutput(dp)
+			}
+		}
+
 		if cfg.Pulse != "" {
 			if dp, ok := p.(DigitalOutputPin); !ok {
 				fmt.Println("Pin cannot be used for pulses", name)
 				os.Exit(1)
 			} else {
-				pp, err := NewPulsingOutput(dp, cfg.Pulse)
+				pp, err := NewPulsingOutput(dp, cfg)
 				if err != nil {
 					fmt.Println("Cannot configure pulsing", err)
 					os.Exit(1)
@@ -83,6 +155,10 @@ func main() {
 			ph = newOutputPinHandler(name, pin, cfg)
 		case DigitalOutputPin:
 			ph = newOutputPinHandler(name, WrapDigitalOutput(pin), cfg)
+		case BusPin:
+			ph = newOutputPinHandler(name, WrapBus(pin), cfg)
+		case AnalogueOutputPin:
+			ph = newOutputPinHandler(name, WrapAnalogueOutput(pin), cfg)
 		default:
 			fmt.Println("Can't handle pin type as output", pin)
 		}
@@ -112,7 +188,7 @@ func main() {
 		}
 
 		if cfg.Invert {
-			if dp, ok := p.(DigitalInputPin); !ok {
+			if dp, ok := p.(ActiveLowPin); !ok {
 				fmt.Println("Pin doesn't support inverted operation", name)
 				os.Exit(1)
 			} else if err = dp.SetActiveLow(); err != nil {
@@ -121,16 +197,38 @@ func main() {
 			}
 		}
 
-		if cfg.OnRising != "" || cfg.OnFalling != "" {
-			if tp, ok := p.(TriggeringPin); !ok {
-				fmt.Println("Pin cannot be used for event triggers", name)
+		if cfg.Bias != "" {
+			if bp, ok := p.(BiasedPin); !ok {
+				fmt.Println("Pin doesn't support bias configuration", name)
 				os.Exit(1)
-			} else if err := myTriggers.Add(tp, cfg.OnRising, cfg.OnFalling, cfg.Method, cfg.Payload); err != nil {
-				fmt.Println("Bad input", name, err)
+			} else if err = setBias(bp, cfg.Bias); err != nil {
+				fmt.Println("Bad input (can't set bias)", name, err)
 				os.Exit(1)
 			}
 		}
 
+		if cfg.FullScale != 0 {
+			if fp, ok := p.(FullScalePin); !ok {
+				fmt.Println("Pin doesn't support setting full-scale range", name)
+				os.Exit(1)
+			} else if err = fp.SetFullScale(cfg.FullScale); err != nil {
+				fmt.Println("Bad input (can't set full-scale range)", name, err)
+				os.Exit(1)
+			}
+		}
+
+		if cfg.SampleRate != 0 {
+			if sp, ok := p.(SampleRatePin); !ok {
+				fmt.Println("Pin doesn't support setting sample rate", name)
+				os.Exit(1)
+			} else if err = sp.SetSampleRate(cfg.SampleRate); err != nil {
+				fmt.Println("Bad input (can't set sample rate)", name, err)
+				os.Exit(1)
+			}
+		}
+
+		// Debouncing is set up before triggers, which depend on whether
+		// the hardware can do it
 		if cfg.Debounce != "" {
 			debounce, err := time.ParseDuration(cfg.Debounce)
 			if err != nil {
@@ -142,27 +240,144 @@ func main() {
 				fmt.Println("Pin doesn't support debouncing", name)
 				os.Exit(1)
 			} else if err = dp.SetDebounce(debounce); err != nil {
-				fmt.Println("Bad input (can't set active low)", name, err)
+				fmt.Println("Bad input (can't set debounce)", name, err)
 				os.Exit(1)
 			}
 		}
 
-		var ph PinHandler = nil
+		// Thresholds and the comparator are only for triggering webhooks
+		hasThresholds := cfg.High != nil || cfg.Low != nil
+		hasTriggers := cfg.OnRising != "" || cfg.OnFalling != ""
+		if (hasThresholds || cfg.Alert != "") && !hasTriggers {
+			fmt.Println("Thresholds and Alert need OnRising or OnFalling", name)
+			os.Exit(1)
+		}
+		softThresholds := hasThresholds && cfg.Alert == ""
+
+		// Scaling applies to thresholds as well as readings
+		var scale scaleFunc
+		if cfg.Scaling != nil {
+			if ap, ok := p.(AnalogueInputPin); !ok {
+				fmt.Println("Pin can't be scaled", name)
+				os.Exit(1)
+			} else if scale, err = newScaleFunc(ap, *cfg.Scaling); err != nil {
+				fmt.Println("Bad input (can't scale)", name, err)
+				os.Exit(1)
+			}
+		}
+
+		// Analogue inputs are sampled in the background when needed
+		var sampler *Sampler
+		if cfg.SamplePeriod != "" || cfg.Filter != "" || softThresholds {
+			period := defaultSamplePeriod
+			if cfg.SamplePeriod != "" {
+				if period, err = time.ParseDuration(cfg.SamplePeriod); err != nil {
+					fmt.Println("Can't parse sample period for", name)
+					os.Exit(1)
+				}
+			}
+
+			f, err := newFilter(cfg.Filter, cfg.FilterLength)
+			if err != nil {
+				fmt.Println("Bad input (filter)", name, err)
+				os.Exit(1)
+			}
+
+			if ap, ok := p.(AnalogueInputPin); !ok {
+				fmt.Println("Pin can't be sampled", name)
+				os.Exit(1)
+			} else if sampler, err = NewSampler(ap, period, f); err != nil {
+				fmt.Println("Bad input (can't sample)", name, err)
+				os.Exit(1)
+			}
+		}
+
+		// Thresholds are compared by the hardware when there's an
+		// alert pin, or else in software
+		var tp TriggeringPin
+		if hasThresholds {
+			low, high, err := thresholds(cfg)
+			if err != nil {
+				fmt.Println("Bad input (thresholds)", name, err)
+				os.Exit(1)
+			}
+
+			if softThresholds {
+				tp = NewThresholdTrigger(sampler, scale, low, high)
+			} else {
+				cp, ok := p.(ComparatorPin)
+				ap, isAnalogue := p.(AnalogueInputPin)
+				if !ok || !isAnalogue {
+					fmt.Println("Pin doesn't support a comparator", name)
+					os.Exit(1)
+				}
+
+				rawLow, rawHigh, err := rawThresholds(ap, scale, low, high)
+				if err != nil {
+					fmt.Println("Bad input (thresholds)", name, err)
+					os.Exit(1)
+				} else if err = setComparator(cp, cfg.Alert, rawLow, rawHigh); err != nil {
+					fmt.Println("Bad input (can't set comparator)", name, err)
+					os.Exit(1)
+				}
+			}
+		} else if cfg.Alert != "" {
+			fmt.Println("Comparator needs High or Low thresholds", name)
+			os.Exit(1)
+		}
+
+		if tp == nil {
+			tp, _ = p.(TriggeringPin)
+		}
+
+		if hasTriggers {
+			if tp == nil {
+				fmt.Println("Pin cannot be used for event triggers", name)
+				os.Exit(1)
+			} else if err := myTriggers.Add(name, tp, cfg.OnRising, cfg.OnFalling, cfg.Method, cfg.Payload); err != nil {
+				fmt.Println("Bad input", name, err)
+				os.Exit(1)
+			}
+		}
+
+		var gp GenericInputPin = nil
 		switch pin := p.(type) {
 		case GenericInputPin:
-			ph = newInputPinHandler(name, pin, cfg)
+			gp = pin
 		case DigitalInputPin:
-			ph = newInputPinHandler(name, WrapDigitalInput(pin), cfg)
+			gp = WrapDigitalInput(pin)
 		case AnalogueInputPin:
-			ph = newInputPinHandler(name, WrapAnalogueInput(pin), cfg)
+			if gp, err = WrapAnalogueInput(pin, sampler, scale, cfg); err != nil {
+				fmt.Println("Bad input (precision)", name, err)
+				os.Exit(1)
+			}
+		case BusPin:
+			gp = WrapBus(pin)
 		default:
 			fmt.Println("Can't handle pin type as input", pin)
 		}
 
-		if ph != nil {
+		if gp != nil {
+			ph := newInputPinHandler(name, gp, cfg)
 			myHandlers.Add(ph)
 			myTriggers.AddContext(ph)
 		}
+
+		if cfg.LogPeriod != "" {
+			period, err := time.ParseDuration(cfg.LogPeriod)
+			if err != nil {
+				fmt.Println("Can't parse log period for", name)
+				os.Exit(1)
+			}
+
+			if vp, ok := gp.(valuedPin); !ok {
+				fmt.Println("Pin can't be logged", name)
+				os.Exit(1)
+			} else if err = logHistory(myHandlers.Cfg.HistoryDir, name, vp, period); err != nil {
+				fmt.Println("Bad input (can't log)", name, err)
+				os.Exit(1)
+			}
+		}
 	}
 
 	if cfg.ClientConfig.UseMDNS {
@@ -172,6 +387,7 @@ func main() {
 	go myTriggers.Wait()
 
 	http.Handle("/", myHandlers)
+	addAPIHandlers()
 
 	if err := http.ListenAndServe(cfg.ServerConfig.ListenAddress, nil); err != nil {
 		fmt.Println(err)
@@ -179,18 +395,57 @@ func main() {
 	}
 }
 
-func getPin(name string) (interface{}, error) {
-	if gpiochip.RecognisePin(name) {
-		return gpiochip.CreatePin(name)
+// setBias applies one of the bias settings allowed in the config file
+func setBias(p BiasedPin, bias string) error {
+	switch bias {
+	case "pull-up":
+		return p.SetPullUp()
+	case "pull-down":
+		return p.SetPullDown()
+	case "disabled":
+		return p.SetBiasDisabled()
 	}
 
-	if ads1015.RecognisePin(name) {
-		return ads1015.CreatePin(name)
+	return fmt.Errorf("Unknown bias %q (expected pull-up, pull-down or disabled)", bias)
+}
+
+// setDrive applies one of the drive settings allowed in the config file
+func setDrive(p DrivenPin, drive string) error {
+	switch drive {
+	case "push-pull":
+		return p.SetPushPull()
+	case "open-drain":
+		return p.SetOpenDrain()
+	case "open-source":
+		return p.SetOpenSource()
 	}
 
-	if fakeio.RecognisePin(name) {
-		return fakeio.CreatePin(name)
+	return fmt.Errorf("Unknown drive %q (expected push-pull, open-drain or open-source)", drive)
+}
+
+// setComparator prepares the alert input for a comparator and starts it
+func setComparator(p ComparatorPin, alert string, low, high int) error {
+	ap, err := getPin(alert)
+	if err != nil {
+		return err
 	}
 
-	return nil, fmt.Errorf("Unknown pin type: %v", name)
+	if ip, ok := ap.(InputPin); !ok {
+		return fmt.Errorf("Alert pin %v can't be used as an input", alert)
+	} else if err = ip.SetInput(); err != nil {
+		return err
+	}
+
+	// The alert output is open-drain, so pull it up if possible
+	if bp, ok := ap.(BiasedPin); ok {
+		if err = bp.SetPullUp(); err != nil {
+			fmt.Println("Can't pull up alert pin", alert, err)
+		}
+	}
+
+	return p.SetComparator(ap, low, high)
+}
+
+func getPin(name string) (interface{}, error) {
+	return driver.CreatePin(name)
 }
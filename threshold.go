@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mhp/tacoma/driver"
+)
+
+// thresholds gives the levels at which an input configured with High,
+// Low and Hysteresis goes high and then low again.  Either both High and
+// Low are given, or one of them along with the Hysteresis between them.
+func thresholds(cfg Input) (low, high float64, err error) {
+	switch {
+	case cfg.High != nil && cfg.Low != nil:
+		if cfg.Hysteresis != 0 {
+			return 0, 0, errors.New("Hysteresis can't be used with both High and Low")
+		}
+		low, high = *cfg.Low, *cfg.High
+	case cfg.High != nil:
+		low, high = *cfg.High-cfg.Hysteresis, *cfg.High
+	case cfg.Low != nil:
+		low, high = *cfg.Low, *cfg.Low+cfg.Hysteresis
+	default:
+		return 0, 0, errors.New("No High or Low threshold")
+	}
+
+	if low > high {
+		return 0, 0, errors.New("Low threshold is above High threshold")
+	}
+
+	return low, high, nil
+}
+
+// rawThresholds converts thresholds into the raw readings at which they
+// are crossed, for a comparator which only sees raw readings.  Every
+// reading is scaled to find them, so the scale must not fall as the
+// reading rises.
+func rawThresholds(p AnalogueInputPin, scale scaleFunc, low, high float64) (rawLow, rawHigh int, err error) {
+	if scale == nil {
+		return int(math.Ceil(low)), int(math.Floor(high)), nil
+	}
+
+	// Crossing high is a reading above rawHigh, and crossing low is one
+	// below rawLow
+	rawLow, rawHigh = p.MaxValue()+1, p.MinValue()-1
+	last := math.Inf(-1)
+	for raw := p.MinValue(); raw <= p.MaxValue(); raw++ {
+		v, err := scale(raw)
+		if err != nil {
+			continue
+		}
+		if v < last {
+			return 0, 0, errors.New("Comparator thresholds need a Scaling which rises with the reading")
+		}
+		last = v
+
+		if v >= low && rawLow > p.MaxValue() {
+			rawLow = raw
+		}
+		if v <= high {
+			rawHigh = raw
+		}
+	}
+
+	if rawLow > p.MaxValue() || rawHigh < p.MinValue() {
+		return 0, 0, fmt.Errorf("Thresholds %v and %v are outside the range of the input", low, high)
+	}
+	return rawLow, rawHigh, nil
+}
+
+// maxPendingCrossings is how many edges a ThresholdTrigger holds before
+// it starts dropping them
+const maxPendingCrossings = 16
+
+// ThresholdTrigger makes edges from an analogue input, rising when a
+// reading goes above high and falling when one then goes below low.
+// Readings come from a Sampler, and are scaled before comparing if
+// there's a scale.  Edges are passed on through a pipe so that they can
+// be handled by Triggers like any other input.
+type ThresholdTrigger struct {
+	s         *Sampler
+	scale     scaleFunc
+	low, high float64
+	wfd       int
+
+	lock sync.Mutex
+	// known is set once the first reading has decided whether the
+	// input is above or below the thresholds
+	known, above bool
+	pending      []driver.Edge
+	dropped      int
+}
+
+func NewThresholdTrigger(s *Sampler, scale scaleFunc, low, high float64) *ThresholdTrigger {
+	return &ThresholdTrigger{s: s, scale: scale, low: low, high: high, wfd: -1}
+}
+
+func (t *ThresholdTrigger) GetEpollEvent(onRising, onFalling bool) (*syscall.EpollEvent, error) {
+	pipes := make([]int, 2)
+
+	if err := syscall.Pipe2(pipes, syscall.O_CLOEXEC|syscall.O_NONBLOCK); err != nil {
+		return nil, err
+	}
+
+	t.wfd = pipes[1]
+	t.s.Watch(t.sample)
+
+	return &syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(pipes[0])}, nil
+}
+
+// sample is called with each reading, queueing an edge when a
+// threshold is crossed
+func (t *ThresholdTrigger) sample(raw int, at time.Time) {
+	v := float64(raw)
+	if t.scale != nil {
+		var err error
+		if v, err = t.scale(raw); err != nil {
+			return
+		}
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var rising bool
+	switch {
+	case !t.known:
+		// Nothing has crossed yet, just note where the input starts
+		t.known, t.above = true, v > t.high
+		return
+	case !t.above && v > t.high:
+		rising = true
+	case t.above && v < t.low:
+		rising = false
+	default:
+		return
+	}
+	t.above = rising
+
+	if len(t.pending) >= maxPendingCrossings {
+		t.dropped++
+		return
+	}
+	t.pending = append(t.pending, driver.Edge{Rising: rising, Time: at})
+
+	// Wake up epoll.  If the pipe is full, it's readable anyway.
+	syscall.Write(t.wfd, []byte{0})
+}
+
+func (t *ThresholdTrigger) IdentifyEdges(e *syscall.EpollEvent) ([]driver.Edge, int) {
+	// First, read from the pipe to drain it
+	buf := make([]byte, maxPendingCrossings)
+	for {
+		if n, err := syscall.Read(int(e.Fd), buf); n <= 0 || err != nil {
+			break
+		}
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	edges, dropped := t.pending, t.dropped
+	t.pending, t.dropped = nil, 0
+
+	return edges, dropped
+}
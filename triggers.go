@@ -1,11 +1,15 @@
 package main
 
 import (
+	"expvar"
 	"fmt"
 	"net/http"
+	"sort"
 	"strings"
 	"syscall"
 	"text/template"
+
+	"github.com/mhp/tacoma/driver"
 )
 
 const DefaultMethod = "PUT"
@@ -14,6 +18,7 @@ const DefaultTemplate = "{{if .RisingEdge}}1{{else}}0{{end}}"
 var Client http.Client
 
 type triggerInfo struct {
+	name      string
 	p         TriggeringPin
 	onRising  string
 	onFalling string
@@ -86,7 +91,7 @@ func NewTriggers() (*Triggers, error) {
 	return &Triggers{fd, make(map[int]triggerInfo)}, nil
 }
 
-func (t *Triggers) Add(p TriggeringPin, onRising string, onFalling string, method string, payload string) error {
+func (t *Triggers) Add(name string, p TriggeringPin, onRising string, onFalling string, method string, payload string) error {
 	if method == "" {
 		method = DefaultMethod
 	}
@@ -110,7 +115,7 @@ func (t *Triggers) Add(p TriggeringPin, onRising string, onFalling string, metho
 		return fmt.Errorf("epoll: %v", err)
 	}
 
-	t.pins[int(ev.Fd)] = triggerInfo{p, onRising, onFalling, method, tpl}
+	t.pins[int(ev.Fd)] = triggerInfo{name, p, onRising, onFalling, method, tpl}
 
 	return nil
 }
@@ -131,31 +136,61 @@ func (*Triggers) AddContext(p PinHandler) {
 	pinMap[p.Endpoint()] = p
 }
 
+// maxEpollEvents is how many ready pins are handled per wakeup
+const maxEpollEvents = 16
+
+// droppedEvents counts, per input, edges lost before they could be read
+var droppedEvents = expvar.NewMap("droppedEvents")
+
+// pendingEdge is an edge waiting to be sent, once all the edges
+// noticed at the same wakeup have been put in order
+type pendingEdge struct {
+	ti *triggerInfo
+	driver.Edge
+}
+
 func (t *Triggers) Wait() {
-	events := make([]syscall.EpollEvent, 1)
+	events := make([]syscall.EpollEvent, maxEpollEvents)
 
 	for {
 		n, err := syscall.EpollWait(t.epollFd, events, -1)
-		if err != nil && err != syscall.EINTR {
+		if err == syscall.EINTR {
+			continue
+		} else if err != nil {
 			fmt.Println("epoll_wait returned error:", err)
 			return
 		}
 
-		if n > 0 {
-			fd := int(events[0].Fd)
+		var pending []pendingEdge
+		for i := range events[:n] {
+			fd := int(events[i].Fd)
 
-			if ti, ok := t.pins[fd]; ok {
-				r, f := ti.p.IdentifyEdge(&events[0])
+			ti, ok := t.pins[fd]
+			if !ok {
+				fmt.Println("epoll returned event for unrecognised fd", fd)
+				continue
+			}
 
-				if r {
-					ti.SendRising()
-				}
+			edges, dropped := ti.p.IdentifyEdges(&events[i])
+			if dropped > 0 {
+				fmt.Println("Input", ti.name, "dropped", dropped, "events")
+				droppedEvents.Add(ti.name, int64(dropped))
+			}
+
+			for _, e := range edges {
+				pending = append(pending, pendingEdge{&ti, e})
+			}
+		}
+
+		sort.SliceStable(pending, func(i, j int) bool {
+			return pending[i].Time.Before(pending[j].Time)
+		})
 
-				if f {
-					ti.SendFalling()
-				}
+		for _, e := range pending {
+			if e.Rising {
+				e.ti.SendRising()
 			} else {
-				fmt.Println("epoll returned event for unrecognised fd", fd)
+				e.ti.SendFalling()
 			}
 		}
 	}
@@ -48,7 +48,7 @@ func (hs Handlers) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	    <td>{{.Endpoint}}{{if not .Exported}}<i> (Unexported)</i>{{end}}</td>
 	    <td>{{if .Inverted}}!{{end}}{{.PinName}}</td>
 	    <td>{{.Direction}}</td>
-	    <td>{{.String}}</td>
+	    <td>{{.String}}{{with .Units}} {{.}}{{end}}{{with .Fault}} <b>Fault: {{.}}</b>{{end}}</td>
 	  </tr>
 	{{ end }}</tbody>
 	</table>
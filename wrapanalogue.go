@@ -1,22 +1,171 @@
 package main
 
 import (
+	"fmt"
+	"net/url"
 	"strconv"
+	"strings"
 )
 
 type wrappedAI struct {
 	AnalogueInputPin
+	// sampler gives readings taken in the background, or is nil to
+	// read the pin on demand
+	sampler *Sampler
+	// scale converts readings to engineering units, or is nil to
+	// give raw readings
+	scale scaleFunc
+	// units describe the reading, but are kept out of it so that it
+	// can be parsed as a number
+	units     string
+	precision int
 }
 
-func WrapAnalogueInput(p AnalogueInputPin) GenericInputPin {
-	return &wrappedAI{p}
+// defaultPrecision is the number of decimal places for scaled readings
+const defaultPrecision = 2
+
+func WrapAnalogueInput(p AnalogueInputPin, s *Sampler, scale scaleFunc, cfg Input) (GenericInputPin, error) {
+	w := &wrappedAI{AnalogueInputPin: p, sampler: s, scale: scale, units: cfg.Units, precision: defaultPrecision}
+
+	if cfg.Precision != nil {
+		if *cfg.Precision < 0 {
+			return nil, fmt.Errorf("Negative precision %v", *cfg.Precision)
+		}
+		w.precision = *cfg.Precision
+	}
+
+	return w, nil
 }
 
+// read gives the latest sample if there's a sampler, or else takes
+// a reading
+func (p *wrappedAI) read() (int, error) {
+	if p.sampler != nil {
+		return p.sampler.Latest()
+	}
+	return p.ReadValue()
+}
+
+// Read gives the reading in engineering units
 func (p *wrappedAI) Read() (string, error) {
+	v, err := p.read()
+	if err != nil {
+		return "n/a", nil
+	}
+
+	if p.scale == nil {
+		return strconv.Itoa(v), nil
+	}
+
+	scaled, err := p.scale(v)
+	if err != nil {
+		return "n/a", nil
+	}
+
+	return strconv.FormatFloat(scaled, 'f', p.precision, 64), nil
+}
+
+// Units gives the units of the reading, for display
+func (p *wrappedAI) Units() string {
+	return p.units
+}
+
+// Value gives the reading in engineering units, for logging
+func (p *wrappedAI) Value() (float64, error) {
+	v, err := p.read()
+	if err != nil {
+		return 0, err
+	}
+
+	if p.scale == nil {
+		return float64(v), nil
+	}
+	return p.scale(v)
+}
+
+func (p *wrappedAI) Queries() []string {
+	return []string{"raw", "volts", "units"}
+}
+
+// ReadQuery supports ?raw, giving the unscaled and unfiltered reading
+// straight from the pin, ?units, giving the units of the reading, and
+// ?volts, converting the reading to volts for pins which know their
+// full-scale range
+func (p *wrappedAI) ReadQuery(q url.Values) (string, error) {
+	if _, ok := q["units"]; ok {
+		return p.units, nil
+	}
+
+	if _, ok := q["raw"]; ok {
+		v, err := p.ReadValue()
+		if err != nil {
+			return "", err
+		}
+		return strconv.Itoa(v), nil
+	}
+
+	if _, ok := q["volts"]; !ok {
+		return "", queryError("Unsupported query " + q.Encode())
+	}
+
+	fp, ok := p.AnalogueInputPin.(FullScalePin)
+	if !ok {
+		return "", queryError("Pin has no full-scale range")
+	}
+
+	v, err := p.read()
+	if err != nil {
+		return "", err
+	}
+
+	volts := float64(v) * fp.FullScale() / float64(p.MaxValue()+1)
+	return strconv.FormatFloat(volts, 'f', 4, 64), nil
+}
+
+type wrappedAO struct {
+	AnalogueOutputPin
+}
+
+func WrapAnalogueOutput(p AnalogueOutputPin) GenericOutputPin {
+	return &wrappedAO{p}
+}
+
+// Write accepts either a percentage of the range ("25%") or a raw value
+func (p *wrappedAO) Write(value string) error {
+	value = strings.TrimSpace(value)
+
+	if strings.HasSuffix(value, "%") {
+		pct, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil {
+			return err
+		}
+		if pct < 0 || pct > 100 {
+			return fmt.Errorf("Percentage out of range: %v", value)
+		}
+
+		span := float64(p.MaxValue() - p.MinValue())
+		return p.WriteValue(p.MinValue() + int(span*pct/100+0.5))
+	}
+
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	return p.WriteValue(v)
+}
+
+// Read gives the value as a percentage of the range, as accepted by Write
+func (p *wrappedAO) Read() (string, error) {
 	v, err := p.ReadValue()
 	if err != nil {
 		return "n/a", nil
 	}
 
-	return strconv.Itoa(v), nil
+	span := p.MaxValue() - p.MinValue()
+	if span <= 0 {
+		return "n/a", nil
+	}
+
+	pct := float64(v-p.MinValue()) * 100 / float64(span)
+	return strconv.FormatFloat(pct, 'f', 1, 64) + "%", nil
 }
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type wrappedBus struct {
+	BusPin
+}
+
+func WrapBus(p BusPin) GenericOutputPin {
+	return &wrappedBus{p}
+}
+
+// Write accepts a number in decimal, or in hex, octal or binary
+// with a 0x, 0o or 0b prefix
+func (p *wrappedBus) Write(value string) error {
+	v, err := strconv.ParseUint(strings.TrimSpace(value), 0, 64)
+	if err != nil {
+		return err
+	}
+
+	if v>>uint(p.Width()) != 0 {
+		return fmt.Errorf("Value %v too wide for %v-bit bus", v, p.Width())
+	}
+
+	return p.WriteBits(v)
+}
+
+func (p *wrappedBus) Read() (string, error) {
+	v, err := p.ReadBits()
+	if err != nil {
+		return "n/a", nil
+	}
+
+	return strconv.FormatUint(v, 10), nil
+}
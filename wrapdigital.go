@@ -24,6 +24,19 @@ func (p *wrappedDI) Read() (string, error) {
 	return "0", nil
 }
 
+// Value gives the level as 0 or 1, for logging
+func (p *wrappedDI) Value() (float64, error) {
+	v, err := p.ReadBool()
+	if err != nil {
+		return 0, err
+	}
+
+	if v {
+		return 1, nil
+	}
+	return 0, nil
+}
+
 type wrappedDO struct {
 	DigitalOutputPin
 }
@@ -33,18 +46,7 @@ func WrapDigitalOutput(p DigitalOutputPin) GenericOutputPin {
 }
 
 func (p *wrappedDO) Write(value string) error {
-	var v bool
-
-	switch {
-	case strings.HasPrefix(value, "false"),
-		strings.HasPrefix(value, "low"),
-		strings.HasPrefix(value, "0"):
-		v = false
-	default:
-		v = true
-	}
-
-	return p.WriteBool(v)
+	return p.WriteBool(parseLevel(value))
 }
 
 func (p *wrappedDO) Read() (string, error) {
@@ -58,3 +60,15 @@ func (p *wrappedDO) Read() (string, error) {
 	}
 	return "0", nil
 }
+
+// parseLevel interprets the body of a PUT to a digital output
+func parseLevel(value string) bool {
+	switch {
+	case strings.HasPrefix(value, "false"),
+		strings.HasPrefix(value, "low"),
+		strings.HasPrefix(value, "0"):
+		return false
+	}
+
+	return true
+}